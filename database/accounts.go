@@ -20,22 +20,37 @@ import (
 )
 
 type CustomClaim struct {
-	ID string
+	ID        string
+	SessionID string
 	jwt.RegisteredClaims
 }
 
+// initializeChannel creates the channel's Mux live stream and stores it. The
+// live stream is deleted again when the channel can't be saved, so a failed
+// signup leaves nothing behind at Mux.
 func (db *BUN) initializeChannel(user_id string) (bool, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	mux, err := db.createUserStreamInfo()
+	stream, err := db.createUserStreamInfo()
+
+	if err != nil {
+		fmt.Println("Could not create live stream: ", err)
+		return false, ErrStreamUnavailable
+	}
+
+	if len(stream.Data.PlaybackIds) == 0 {
+		db.deleteLiveStream(stream.Data.Id)
+		return false, ErrStreamUnavailable
+	}
 
 	res, err := db.client.NewRaw(
-		"INSERT INTO channels (id, user_id, title, notification, category, streamkey, playback_id, livestream_id, tags, is_branded, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO UPDATE SET title=EXCLUDED.title, notification=EXCLUDED.notification, tags=EXCLUDED.tags",
-		id, user_id, "Channel Title", "Come Chill", "all", mux.Data.StreamKey, mux.Data.PlaybackIds[0].Id, mux.Data.Id, "", false, now,
+		"INSERT INTO channels (id, user_id, title, notification, category, streamkey, playback_id, livestream_id, tags, is_branded, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO NOTHING",
+		id, user_id, "Channel Title", "Come Chill", "all", stream.Data.StreamKey, stream.Data.PlaybackIds[0].Id, stream.Data.Id, "", false, now,
 	).Exec(context.Background())
 
 	if err != nil {
+		db.deleteLiveStream(stream.Data.Id)
 		return false, err
 	}
 	rows, err := res.RowsAffected()
@@ -48,6 +63,9 @@ func (db *BUN) initializeChannel(user_id string) (bool, error) {
 		return true, nil
 	}
 
+	// the channel already had a live stream.
+	db.deleteLiveStream(stream.Data.Id)
+
 	return false, nil
 }
 
@@ -73,8 +91,7 @@ func (db *BUN) deleteChannel(user_id string) (bool, error) {
 }
 
 func (db *BUN) createUserStreamInfo() (muxgo.LiveStreamResponse, error) {
-	client := muxgo.NewAPIClient(
-		muxgo.NewConfiguration(muxgo.WithBasicAuth(os.Getenv("MUX_ACCESS"), os.Getenv("MUX_SECRET"))))
+	client := muxClient()
 
 	// generate livestream.
 	car := muxgo.CreateAssetRequest{PlaybackPolicy: []muxgo.PlaybackPolicy{muxgo.PUBLIC}}
@@ -102,7 +119,13 @@ func (db *BUN) deleteLiveStream(id string) (bool, error) {
 	return true, nil
 }
 
-func (db *BUN) createStripeCustomer(user model.User) model.User {
+// stripeCustomer returns the user's Stripe customer id, creating the customer
+// the first time it is needed.
+func (db *BUN) stripeCustomer(user *model.User) (string, error) {
+	if user.StripeCustomerID != "" {
+		return user.StripeCustomerID, nil
+	}
+
 	stripe_secret := os.Getenv("STRIPE_SECRET_KEY")
 	stripe.Key = stripe_secret
 
@@ -110,31 +133,26 @@ func (db *BUN) createStripeCustomer(user model.User) model.User {
 		Email: &user.Email,
 		Name:  &user.Name,
 	}
+	params.AddMetadata("user_id", user.ID)
 
 	c, err := customer.New(params)
 
 	if err != nil {
 		fmt.Println("Could not create Customer: ", err)
+		return "", err
 	}
 
 	// update user database entry.
-	row, err := db.client.NewUpdate().Model(&user).Set("stripe_customer_id = ?", c.ID).Where("id = ?", user.ID).Returning("*").Exec(context.Background())
+	_, err = db.client.NewRaw("UPDATE users SET stripe_customer_id = ?, updated_at = ? WHERE id = ?", c.ID, time.Now(), user.ID).Exec(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not update stripe customer id in users table: ", err)
+		return "", err
 	}
 
-	rows, err := row.RowsAffected()
-
-	if err != nil {
-		fmt.Println("Something went wrong when fetching updated rows affected: ", err)
-	}
-
-	if rows > 0 {
-		fmt.Println("Successfully created stripe customer id")
-	}
+	user.StripeCustomerID = c.ID
 
-	return user
+	return c.ID, nil
 }
 
 func (db *BUN) registerUser(email string) (*model.User, bool) {
@@ -233,6 +251,13 @@ func (db *BUN) CreateUser(input *model.NewUser) (string, error) {
 
 		isMade, err := db.initializeChannel(id)
 
+		if err != nil {
+			// without a channel the account is unusable, remove it so signing
+			// up can be retried.
+			db.client.NewRaw("DELETE FROM users WHERE id = ?", id).Exec(context.Background())
+			return "", err
+		}
+
 		if isMade {
 			// send email.
 			utils.SendMail(
@@ -280,31 +305,13 @@ func (db *BUN) UpdateUser(id string, input *model.UpdateUser) (bool, error) {
 	return true, nil
 }
 
+// UpdateUserStripe is kept for older clients. Customer ids are set by checkout
+// and payout eligibility by Stripe, so input is ignored.
 func (db *BUN) UpdateUserStripe(id string, input *model.UserStripeInput) (bool, error) {
-	var now = time.Now()
-
-	row, err := db.client.NewRaw(
-		"UPDATE users SET stripe_customer_id = ?, stripe_connected_link = ?, updated_at = ? WHERE id = ?",
-		input.StripeCustomerID, input.StripeConnectedLink, now, id,
-	).Exec(context.Background())
-
-	if err != nil {
-		fmt.Println("Error updating user: ", err)
-		return false, err
-	}
-
-	rows, err := row.RowsAffected()
-
-	if err != nil {
-		fmt.Println("Something went wrong. ", err)
+	if _, err := db.GetUser(id); err != nil {
 		return false, err
 	}
 
-	if rows > 0 {
-		fmt.Println("Updated User Successfully...", input.StripeConnectedLink)
-		return true, nil
-	}
-
 	return true, nil
 }
 
@@ -379,10 +386,12 @@ func (db *BUN) DeleteUser(id string) (bool, error) {
 	}
 
 	if rows > 0 {
-		channel, _ := db.GetChannelInfo(id)
-		liveDeleted, _ := db.deleteLiveStream(channel.LivestreamID)
-		if liveDeleted {
-			fmt.Println("deleted livestream from mux successfully")
+		channel, err := db.GetChannelInfo(id)
+		if err == nil && channel.LivestreamID != "" {
+			liveDeleted, _ := db.deleteLiveStream(channel.LivestreamID)
+			if liveDeleted {
+				fmt.Println("deleted livestream from mux successfully")
+			}
 		}
 		db.deleteChannel(id)
 		return true, nil
@@ -503,14 +512,13 @@ func (db *BUN) createLoginToken(user *model.User) (string, error) {
 	// create token and return.
 	token := utils.EncodeToString(6)
 
-	data := model.Token{
-		ID:        uuid.New().String(),
-		UserID:    user.ID,
-		Token:     token,
-		CreatedAt: &now,
-	}
+	// a new code replaces any code that was sent before.
+	db.deleteLoginTokens(user.ID)
 
-	row, err := db.client.NewInsert().Model(&data).Exec(context.Background())
+	row, err := db.client.NewRaw(
+		"INSERT INTO tokens (id, user_id, token, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		uuid.New().String(), user.ID, token, now, now.Add(loginTokenTTL),
+	).Exec(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not insert token into db. ", err)
@@ -557,11 +565,12 @@ func (db *BUN) LoginAccount(email string) (string, error) {
 	return result, err
 }
 
-func JwtGenerate(ctx context.Context, userID string, email string) (string, error) {
+func JwtGenerate(ctx context.Context, userID string, sessionID string, expiresAt time.Time) (string, error) {
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaim{
-		ID: userID,
+		ID:        userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().AddDate(1, 0, 0)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	})
@@ -587,52 +596,83 @@ func JwtValidate(ctx context.Context, token string) (*jwt.Token, error) {
 	})
 }
 
-func (db *BUN) VerifyToken(id string, token string) (string, error) {
+var ErrInvalidLoginToken = errors.New("Invalid login token")
+
+// VerifyLogin exchanges a login code for a new session on the given device.
+func (db *BUN) VerifyLogin(id string, token string, device string, ip string) (*model.AuthPayload, error) {
+	return db.verifyLogin(id, token, ip, func(user_id string) (*model.AuthPayload, error) {
+		return db.CreateSession(user_id, device)
+	})
+}
+
+func (db *BUN) verifyLogin(id string, token string, ip string, createSession func(user_id string) (*model.AuthPayload, error)) (*model.AuthPayload, error) {
 	var user model.User
-	var tokenModel model.Token
 
-	count, err := db.client.NewSelect().Model(&tokenModel).Where("token = ?", token).Where("user_id = ?", id).ScanAndCount(context.Background())
+	locked, err := db.loginLocked(id, ip)
+
+	if err != nil {
+		fmt.Println("Could not check login attempts: ", err)
+		return nil, err
+	}
+
+	if locked {
+		return nil, ErrLoginLocked
+	}
+
+	consumed, err := db.consumeLoginToken(id, token)
 
 	if err != nil {
 		fmt.Println("Could not fetch token: ", err)
-		return "No Token", err
+		return nil, err
 	}
 
-	if count > 0 {
-		err := db.client.NewRaw("select * from ? where id = ?", bun.Ident("users"), id).Scan(context.Background(), &user)
+	if !consumed {
+		db.recordFailedLogin(id, ip)
+		return nil, ErrInvalidLoginToken
+	}
 
-		if err != nil {
-			fmt.Println("Could not fetch user: ", err)
-			return "No User", err
-		}
+	err = db.client.NewRaw("select * from ? where id = ?", bun.Ident("users"), id).Scan(context.Background(), &user)
 
-		if user.ID != "" {
-			jwtString, err := JwtGenerate(context.Background(), user.ID, user.Email)
+	if err != nil {
+		fmt.Println("Could not fetch user: ", err)
+		return nil, err
+	}
 
-			if err == nil {
-				// delete token
-				db.client.NewDelete().Model(&tokenModel).Where("token = ?", token).Scan(context.Background())
-			}
+	payload, err := createSession(user.ID)
 
-			// let initialize chat identity if it does not exist.
-			_, errs := db.GetChatIdentity(user.ID)
-			if errs != nil {
-				fmt.Println("Verify Account: Could not load chat identity something went wrong. ", errs)
-				// update chat identity.
-				input := model.ChatIdentityInput{
-					Color: "#FF0000",
-					Badge: "",
-				}
-				db.UpdateChatIdentity(user.ID, input)
-			}
+	if err != nil {
+		return nil, err
+	}
 
-			return jwtString, nil
+	// let initialize chat identity if it does not exist.
+	_, errs := db.GetChatIdentity(user.ID)
+	if errs != nil {
+		fmt.Println("Verify Account: Could not load chat identity something went wrong. ", errs)
+		// update chat identity.
+		input := model.ChatIdentityInput{
+			Color: "#FF0000",
+			Badge: "",
 		}
-	} else {
+		db.UpdateChatIdentity(user.ID, input)
+	}
+
+	return payload, nil
+}
+
+// VerifyToken is kept for clients that only understand a bare access token.
+// They can't refresh, so the token lasts as long as tokens did before sessions.
+func (db *BUN) VerifyToken(id string, token string, ip string) (string, error) {
+	payload, err := db.verifyLogin(id, token, ip, db.createLegacySession)
+
+	if errors.Is(err, ErrInvalidLoginToken) {
 		return "No Token found", nil
 	}
 
-	return "Failed", nil
+	if err != nil {
+		return "Failed", err
+	}
+
+	return payload.AccessToken, nil
 }
 
 func (db *BUN) VerifyEmail(id string, email string) (bool, error) {
@@ -2,11 +2,13 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/glitchd/glitchd-server/graph/model"
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
 func (db *BUN) CreateActivity(sender_id string, target_id string, activity_type string, message string) (*model.Activity, error) {
@@ -66,3 +68,28 @@ func (db *BUN) GetRecentActivity(channelID string) ([]*model.Activity, error) {
 	}
 	return activity, nil
 }
+
+// CreateActivities adds the same activity for every user in target_ids in a
+// single insert.
+func (db *BUN) CreateActivities(sender_id string, target_ids []string, activity_type string, message string) error {
+	if len(target_ids) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(target_ids))
+	for range target_ids {
+		ids = append(ids, uuid.New().String())
+	}
+
+	_, err := db.client.NewRaw(
+		"INSERT INTO activities (id, sender_id, target_id, type, message, created_at) SELECT t.id, ?, t.target_id, ?, ?, ? FROM unnest(?::uuid[], ?::text[]) AS t(id, target_id)",
+		sender_id, activity_type, message, time.Now(), pgdialect.Array(ids), pgdialect.Array(target_ids),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not create activities: ", err)
+		return err
+	}
+
+	return nil
+}
@@ -2,19 +2,36 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/glitchd/glitchd-server/graph/model"
-	"github.com/google/uuid"
 )
 
+var ErrStreamUnavailable = errors.New("Could not set up the stream, please try again")
+
+// CreateChannel saves the channel details of user_id. The stream key and
+// playback id always come from Mux, a channel that has none yet gets its live
+// stream here.
 func (db *BUN) CreateChannel(user_id string, input model.ChannelInput) (bool, error) {
-	id := uuid.New().String()
-	now := time.Now()
+	var exists bool
+
+	err := db.client.NewRaw("SELECT EXISTS (SELECT 1 FROM channels WHERE user_id = ?)", user_id).Scan(context.Background(), &exists)
+
+	if err != nil {
+		return false, err
+	}
+
+	if !exists {
+		if _, err := db.initializeChannel(user_id); err != nil {
+			return false, err
+		}
+	}
 
 	res, err := db.client.NewRaw(
-		"INSERT INTO channels (id, user_id, title, notification, category, streamkey, playback_id, tags, is_branded, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO UPDATE SET title=EXCLUDED.title, notification=EXCLUDED.notification, tags=EXCLUDED.tags",
-		id, input.BroadcasterID, input.Title, input.Notification, input.Category, input.Streamkey, input.PlaybackID, input.Tags, input.IsBranded, now,
+		"UPDATE channels SET title = ?, notification = ?, category = ?, tags = ?, is_branded = ?, updated_at = ? WHERE user_id = ?",
+		input.Title, input.Notification, input.Category, input.Tags, input.IsBranded, time.Now(), user_id,
 	).Exec(context.Background())
 
 	if err != nil {
@@ -36,7 +53,7 @@ func (db *BUN) CreateChannel(user_id string, input model.ChannelInput) (bool, er
 func (db *BUN) UpdateStreamkey(user_id string, streamkey string, playback_id string) (bool, error) {
 	res, err := db.client.NewRaw(
 		"UPDATE channels SET streamkey = ?, playback_id = ? WHERE user_id = ?",
-		streamkey, user_id,
+		streamkey, playback_id, user_id,
 	).Exec(context.Background())
 	if err != nil {
 		return false, err
@@ -55,6 +72,41 @@ func (db *BUN) UpdateStreamkey(user_id string, streamkey string, playback_id str
 	return false, nil
 }
 
+// ResetStreamKey has Mux issue a new stream key for the channel, the old key
+// stops working right away.
+func (db *BUN) ResetStreamKey(user_id string) (*model.Channel, error) {
+	channel, err := db.GetChannelInfo(user_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if channel.LivestreamID == "" {
+		return nil, ErrStreamUnavailable
+	}
+
+	stream, err := muxClient().LiveStreamsApi.ResetStreamKey(channel.LivestreamID)
+
+	if err != nil || stream.Data.StreamKey == "" {
+		fmt.Println("Could not reset stream key: ", err)
+		return nil, ErrStreamUnavailable
+	}
+
+	_, err = db.client.NewRaw(
+		"UPDATE channels SET streamkey = ?, updated_at = ? WHERE user_id = ?",
+		stream.Data.StreamKey, time.Now(), user_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not save stream key: ", err)
+		return nil, err
+	}
+
+	channel.Streamkey = stream.Data.StreamKey
+
+	return channel, nil
+}
+
 func (db *BUN) GetChannelInfo(user_id string) (*model.Channel, error) {
 	var channel model.Channel
 	err := db.client.NewRaw("SELECT * FROM channels WHERE user_id = ?", user_id).Scan(context.Background(), &channel)
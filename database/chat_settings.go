@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/utils"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrSlowMode     = errors.New("Slow mode is on, wait before sending another message")
+	ErrFollowerOnly = errors.New("Only followers can chat in this channel")
+	ErrMemberOnly   = errors.New("Only members can chat in this channel")
+	ErrEmoteOnly    = errors.New("Only emotes are allowed in this chat")
+)
+
+func (db *BUN) GetChatSettings(channel_id string) (*model.ChatSettings, error) {
+	var settings model.ChatSettings
+
+	err := db.client.NewRaw("SELECT * FROM chat_settings WHERE channel_id = ?", channel_id).Scan(context.Background(), &settings)
+
+	// channels without a row have every mode turned off.
+	if errors.Is(err, sql.ErrNoRows) {
+		return &model.ChatSettings{ChannelID: channel_id}, nil
+	}
+
+	if err != nil {
+		fmt.Println("Could not fetch chat settings: ", err)
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (db *BUN) UpdateChatSettings(channel_id string, input model.ChatSettingsInput) (*model.ChatSettings, error) {
+	var settings model.ChatSettings
+
+	if input.SlowModeSeconds < 0 || input.FollowerMinMinutes < 0 {
+		return nil, errors.New("Chat settings cannot be negative")
+	}
+
+	err := db.client.NewRaw(
+		"INSERT INTO chat_settings (channel_id, slow_mode_seconds, follower_only, follower_min_minutes, member_only, emote_only, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (channel_id) DO UPDATE SET slow_mode_seconds=EXCLUDED.slow_mode_seconds, follower_only=EXCLUDED.follower_only, follower_min_minutes=EXCLUDED.follower_min_minutes, member_only=EXCLUDED.member_only, emote_only=EXCLUDED.emote_only, updated_at=EXCLUDED.updated_at RETURNING *",
+		channel_id, input.SlowModeSeconds, input.FollowerOnly, input.FollowerMinMinutes, input.MemberOnly, input.EmoteOnly, time.Now(),
+	).Scan(context.Background(), &settings)
+
+	if err != nil {
+		fmt.Println("Could not update chat settings: ", err)
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// CheckChatModes returns the error for the first chat mode that stops user_id
+// from posting message. Moderators and the channel owner are exempt, and paid
+// messages like tips skip emote-only and slow mode. Slow mode is not checked
+// here but returned, CreateMessage enforces it together with the insert.
+func (db *BUN) CheckChatModes(channel_id string, user_id string, message string, paid bool) (time.Duration, error) {
+	settings, err := db.GetChatSettings(channel_id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if settings.SlowModeSeconds == 0 && !settings.FollowerOnly && !settings.MemberOnly && !settings.EmoteOnly {
+		return 0, nil
+	}
+
+	exempt, err := db.HasRole(user_id, model.RoleModerator, channel_id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if exempt {
+		return 0, nil
+	}
+
+	if settings.EmoteOnly && !paid && !utils.IsEmoteOnly(message) {
+		return 0, ErrEmoteOnly
+	}
+
+	if settings.FollowerOnly {
+		following, _ := db.IsFollowing(channel_id, user_id)
+
+		if !following {
+			return 0, ErrFollowerOnly
+		}
+
+		if settings.FollowerMinMinutes > 0 {
+			follow, err := db.GetFollow(channel_id, user_id)
+
+			if err != nil {
+				return 0, err
+			}
+
+			if time.Since(follow.CreatedAt) < time.Duration(settings.FollowerMinMinutes)*time.Minute {
+				return 0, ErrFollowerOnly
+			}
+		}
+	}
+
+	if settings.MemberOnly {
+		memberships, err := db.GetUserMembership(user_id, channel_id)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if len(memberships) == 0 {
+			return 0, ErrMemberOnly
+		}
+	}
+
+	if paid {
+		return 0, nil
+	}
+
+	return time.Duration(settings.SlowModeSeconds) * time.Second, nil
+}
+
+// checkSlowMode returns ErrSlowMode when user_id posted in the chat of
+// channel_id within slow. It locks the sender in that chat until tx ends, so
+// concurrent messages are checked one after another.
+func checkSlowMode(ctx context.Context, tx bun.Tx, channel_id string, user_id string, slow time.Duration) error {
+	_, err := tx.NewRaw("SELECT pg_advisory_xact_lock(hashtext(?))", "slow_mode:"+channel_id+":"+user_id).Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var recent bool
+
+	// created_at holds the server's local time, so the cutoff is taken here
+	// rather than from NOW().
+	err = tx.NewRaw(
+		"SELECT EXISTS (SELECT 1 FROM messages WHERE channel_id = ? AND sender_id = ? AND created_at > ?)",
+		channel_id, user_id, time.Now().Add(-slow),
+	).Scan(ctx, &recent)
+
+	if err != nil {
+		return err
+	}
+
+	if recent {
+		return ErrSlowMode
+	}
+
+	return nil
+}
@@ -15,7 +15,7 @@ import (
 var DB *BUN
 
 type BUN struct {
-	client *bun.DB
+	client bun.IDB
 }
 
 func Connect() *BUN {
@@ -32,7 +32,8 @@ func Connect() *BUN {
 	if err != nil {
 		panic(err)
 	}
-	conn := bun.NewDB(client, pgdialect.New())
+	// tables carry bookkeeping columns that are not part of the graphql models.
+	conn := bun.NewDB(client, pgdialect.New(), bun.WithDiscardUnknownColumns())
 	fmt.Println("Established Database Connection Successfully!")
 
 	return &BUN{client: conn}
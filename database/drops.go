@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	flakesDrop = "drop"
+
+	minDropDuration = 10 * time.Second
+	maxDropDuration = time.Hour
+	maxDropCode     = 32
+
+	flakesDropColumns = "id, channel_id, code, message, pool, per_claim, max_claims, claims, expires_at, created_at"
+)
+
+var (
+	ErrInvalidDrop      = errors.New("Drops need a code without spaces, a pool of at least one Flake per claimer and a duration between 10 seconds and an hour")
+	ErrDropCodeInUse    = errors.New("A drop with this code is still running")
+	ErrDropNotFound     = errors.New("No running drop with this code")
+	ErrDropClaimed      = errors.New("You already claimed this drop")
+	ErrDropEmpty        = errors.New("This drop has been claimed by everyone already")
+	ErrDropNotInChat    = errors.New("Join the chat to claim drops")
+	ErrDropOwnChannel   = errors.New("You can't claim your own drop")
+	ErrDropNotAvailable = errors.New("The streamer can't pay out this drop anymore")
+)
+
+func normalizeDropCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// CreateFlakesDrop starts a drop in the chat of channel_id and posts the chat
+// message announcing it. The pool is not set aside, every claim is paid from
+// the streamer's balance when it happens.
+func (db *BUN) CreateFlakesDrop(channel_id string, input model.FlakesDropInput) (*model.FlakesDrop, *model.Message, error) {
+	code := normalizeDropCode(input.Code)
+	duration := time.Duration(input.Duration) * time.Second
+
+	if code == "" || len(code) > maxDropCode || strings.ContainsAny(code, " \t\n") ||
+		input.MaxClaims <= 0 || input.Pool < input.MaxClaims ||
+		duration < minDropDuration || duration > maxDropDuration {
+		return nil, nil, ErrInvalidDrop
+	}
+
+	balance, _ := db.GetFlakes(channel_id)
+
+	if balance < input.Pool {
+		return nil, nil, ErrInsufficientFlakes
+	}
+
+	now := time.Now()
+
+	drop := &model.FlakesDrop{
+		ID:        uuid.New().String(),
+		ChannelID: channel_id,
+		Code:      code,
+		Message:   input.Message,
+		Pool:      input.Pool,
+		PerClaim:  input.Pool / input.MaxClaims,
+		MaxClaims: input.MaxClaims,
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	}
+
+	message := &model.Message{
+		ID:          uuid.New().String(),
+		ChannelID:   channel_id,
+		SenderID:    channel_id,
+		IsSent:      true,
+		Message:     input.Message,
+		MessageType: flakesDrop,
+		Amount:      input.Pool,
+		DropCode:    code,
+		DropMessage: input.Message,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	ctx := context.Background()
+
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// one running drop per code, so a claim can't land in the wrong drop.
+		var running bool
+
+		err := tx.NewRaw(
+			"SELECT EXISTS (SELECT 1 FROM flakes_drops WHERE channel_id = ? AND code = ? AND expires_at > ? AND claims < max_claims)",
+			channel_id, code, now,
+		).Scan(ctx, &running)
+
+		if err != nil {
+			return err
+		}
+
+		if running {
+			return ErrDropCodeInUse
+		}
+
+		_, err = tx.NewRaw(
+			"INSERT INTO messages (id, sender_id, channel_id, is_sent, message, message_type, amount, drop_code, drop_message, reply_parent_message_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, '', ?, ?)",
+			message.ID, message.SenderID, channel_id, true, message.Message, message.MessageType, message.Amount, message.DropCode, message.DropMessage, now, now,
+		).Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewRaw(
+			"INSERT INTO flakes_drops (id, channel_id, message_id, code, message, pool, per_claim, max_claims, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			drop.ID, channel_id, message.ID, code, drop.Message, drop.Pool, drop.PerClaim, drop.MaxClaims, drop.ExpiresAt, now,
+		).Exec(ctx)
+
+		return err
+	})
+
+	if err != nil {
+		fmt.Println("Could not create flakes drop: ", err)
+		return nil, nil, err
+	}
+
+	message.Sender, _ = db.GetUser(channel_id)
+
+	return drop, message, nil
+}
+
+// ClaimFlakesDrop pays user_id their share of the running drop with code in
+// channel_id. The drop stays locked while the Flakes move, so it is never
+// claimed more than max_claims times or twice by the same viewer.
+func (db *BUN) ClaimFlakesDrop(channel_id string, user_id string, code string) (*model.FlakesDrop, error) {
+	if channel_id == user_id {
+		return nil, ErrDropOwnChannel
+	}
+
+	if inChat, _ := db.IsUserInChat(channel_id, user_id); !inChat {
+		return nil, ErrDropNotInChat
+	}
+
+	var drop model.FlakesDrop
+	ctx := context.Background()
+
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewRaw(
+			"SELECT "+flakesDropColumns+" FROM flakes_drops WHERE channel_id = ? AND code = ? AND expires_at > ? ORDER BY created_at DESC LIMIT 1 FOR UPDATE",
+			channel_id, normalizeDropCode(code), time.Now(),
+		).Scan(ctx, &drop)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDropNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if drop.Claims >= drop.MaxClaims {
+			return ErrDropEmpty
+		}
+
+		res, err := tx.NewRaw(
+			"INSERT INTO flakes_drop_claims (drop_id, user_id, amount, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			drop.ID, user_id, drop.PerClaim, time.Now(),
+		).Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return ErrDropClaimed
+		}
+
+		_, err = db.applyFlakes(ctx, tx, channel_id, -drop.PerClaim, flakesDrop, drop.ID, "drop:"+drop.ID+":"+user_id)
+
+		if errors.Is(err, ErrInsufficientFlakes) {
+			return ErrDropNotAvailable
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := db.applyFlakes(ctx, tx, user_id, drop.PerClaim, flakesDrop, drop.ID, "drop:"+drop.ID); err != nil {
+			return err
+		}
+
+		drop.Claims++
+
+		_, err = tx.NewRaw("UPDATE flakes_drops SET claims = ? WHERE id = ?", drop.Claims, drop.ID).Exec(ctx)
+
+		return err
+	})
+
+	if err != nil {
+		fmt.Println("Could not claim flakes drop: ", err)
+		return nil, err
+	}
+
+	return &drop, nil
+}
+
+// GetActiveFlakesDrops returns the drops in channel_id that can still be
+// claimed.
+func (db *BUN) GetActiveFlakesDrops(channel_id string) ([]*model.FlakesDrop, error) {
+	drops := []*model.FlakesDrop{}
+
+	err := db.client.NewRaw(
+		"SELECT "+flakesDropColumns+" FROM flakes_drops WHERE channel_id = ? AND expires_at > ? AND claims < max_claims ORDER BY created_at DESC",
+		channel_id, time.Now(),
+	).Scan(context.Background(), &drops)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not fetch flakes drops: ", err)
+		return nil, err
+	}
+
+	return drops, nil
+}
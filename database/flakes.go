@@ -2,107 +2,203 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/glitchd/glitchd-server/graph/model"
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
-func (db *BUN) AddFlakes(user_id string, amount int) (bool, error) {
-	var flakes model.Flakes
+const (
+	flakesCredit   = "credit"
+	flakesTip      = "tip"
+	flakesPurchase = "purchase"
+	flakesRefund   = "refund"
+)
+
+var (
+	ErrInsufficientFlakes = errors.New("Not enough Flakes")
+	ErrInvalidFlakes      = errors.New("Flakes amount must be positive")
+	ErrSelfTip            = errors.New("You cannot tip your own channel")
+)
+
+// applyFlakes moves user_id's balance by delta and records the change in the
+// ledger. The balance row stays locked until tx commits so concurrent changes
+// are applied one after another. When key was already used by user_id nothing
+// is written and replayed is true.
+func (db *BUN) applyFlakes(ctx context.Context, tx bun.Tx, user_id string, delta int, kind string, reference_id string, key string) (replayed bool, err error) {
+	balance, err := db.lockFlakes(ctx, tx, user_id)
+
+	if err != nil {
+		return false, err
+	}
+
+	if key != "" {
+		var used bool
 
-	currentFlakes := db.flakesExist(user_id)
+		err = tx.NewRaw("SELECT EXISTS (SELECT 1 FROM flakes_ledger WHERE user_id = ? AND idempotency_key = ?)", user_id, key).Scan(ctx, &used)
 
-	flakes.ID = uuid.New().String()
-	flakes.UserID = user_id
-	flakes.Amount = amount
-	flakes.CreatedAt = time.Now()
+		if err != nil {
+			return false, err
+		}
 
-	var am int
+		if used {
+			return true, nil
+		}
+	}
 
-	if currentFlakes != nil {
-		am = currentFlakes.Amount + amount
-	} else {
-		am = amount
+	if balance+delta < 0 {
+		return false, ErrInsufficientFlakes
 	}
 
-	_, err := db.client.NewInsert().Model(&flakes).On("CONFLICT (user_id) DO UPDATE").Set("amount = ?", am).Exec(context.Background())
+	_, err = tx.NewRaw("UPDATE flakes SET amount = ? WHERE user_id = ?", balance+delta, user_id).Exec(ctx)
 
 	if err != nil {
-		fmt.Println("Error found when following user: ", err)
 		return false, err
 	}
 
-	return true, nil
-}
+	var idempotencyKey *string
+	if key != "" {
+		idempotencyKey = &key
+	}
+
+	_, err = tx.NewRaw(
+		"INSERT INTO flakes_ledger (id, user_id, delta, balance, kind, reference_id, idempotency_key, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		uuid.New().String(), user_id, delta, balance+delta, kind, reference_id, idempotencyKey, time.Now(),
+	).Exec(ctx)
 
-func (db *BUN) updateFlakes(user_id string, amount int) bool {
-	var flakes model.Flakes
-	res, err := db.client.NewUpdate().Model(&flakes).Set("amount = ?", amount).Where("user_id = ?", user_id).Exec(context.Background())
 	if err != nil {
-		return false
+		return false, err
 	}
 
-	rows, err := res.RowsAffected()
+	return false, nil
+}
+
+// lockFlakes returns user_id's balance and locks it until tx ends, creating an
+// empty wallet when the user has none yet.
+func (db *BUN) lockFlakes(ctx context.Context, tx bun.Tx, user_id string) (int, error) {
+	_, err := tx.NewRaw(
+		"INSERT INTO flakes (id, user_id, amount, created_at) VALUES (?, ?, 0, ?) ON CONFLICT (user_id) DO NOTHING",
+		uuid.New().String(), user_id, time.Now(),
+	).Exec(ctx)
 
 	if err != nil {
-		return false
+		return 0, err
 	}
 
-	if rows > 0 {
-		return true
+	var balance int
+
+	err = tx.NewRaw("SELECT amount FROM flakes WHERE user_id = ? FOR UPDATE", user_id).Scan(ctx, &balance)
+
+	if err != nil {
+		return 0, err
 	}
 
-	return false
+	return balance, nil
 }
 
-func (db *BUN) flakesExist(user_id string) *model.Flakes {
-	var flakes model.Flakes
+func (db *BUN) AddFlakes(user_id string, amount int, idempotency_key string) (bool, error) {
+	if amount <= 0 {
+		return false, ErrInvalidFlakes
+	}
+
+	ctx := context.Background()
 
-	count, err := db.client.NewSelect().Model(&flakes).Where("user_id = ?", user_id).ScanAndCount(context.Background())
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := db.applyFlakes(ctx, tx, user_id, amount, flakesCredit, "", idempotency_key)
+		return err
+	})
 
 	if err != nil {
-		fmt.Println("Could check if flakes exists: ", err)
-		return nil
+		fmt.Println("Could not add flakes: ", err)
+		return false, err
 	}
 
-	if count > 0 {
-		return &flakes
+	return true, nil
+}
+
+// GetTipMessage returns the chat message of the tip user_id sent with
+// idempotency_key, nil when there is none.
+func (db *BUN) GetTipMessage(channel_id string, user_id string, idempotency_key string) (*model.Message, error) {
+	var id string
+
+	err := db.client.NewRaw(
+		"SELECT reference_id FROM flakes_ledger WHERE user_id = ? AND idempotency_key = ? AND kind = ?",
+		user_id, idempotency_key, flakesTip,
+	).Scan(context.Background(), &id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
 	}
 
-	return nil
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetMessage(channel_id, id)
 }
 
-func (db *BUN) SendFlakes(channel_id string, user_id string, amount int) (bool, error) {
-	currentFlakes := db.flakesExist(user_id)
+// SendFlakes tips input.Amount Flakes from the sender to the channel and posts
+// input as the tip's chat message, both or neither. The tip, its ledger entry
+// and the message share one id. When idempotency_key was already used the
+// message of the first call is returned with sent false, so the caller does
+// not announce the same tip twice.
+func (db *BUN) SendFlakes(input *model.NewMessage, idempotency_key string) (message *model.Message, sent bool, err error) {
+	if input.Amount <= 0 {
+		return nil, false, ErrInvalidFlakes
+	}
 
-	if currentFlakes == nil || currentFlakes.Amount == 0 {
-		return false, nil
+	// tips become payable, a streamer could otherwise pay themselves with
+	// Flakes that are refunded later.
+	if input.SenderID == input.ChannelID {
+		return nil, false, ErrSelfTip
 	}
 
+	ctx := context.Background()
 	id := uuid.New().String()
-	res, err := db.client.NewRaw(
-		"INSERT INTO channel_flakes (id, channel_id, sender_id, amount, created_at) VALUES (?, ?, ?, ?, ?)",
-		id, channel_id, user_id, amount, time.Now(),
-	).Exec(context.Background())
 
-	if err != nil {
-		return false, nil
-	}
+	err = db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		replayed, err := db.applyFlakes(ctx, tx, input.SenderID, -input.Amount, flakesTip, id, idempotency_key)
+
+		if err != nil || replayed {
+			return err
+		}
+
+		_, err = tx.NewRaw(
+			"INSERT INTO channel_flakes (id, channel_id, sender_id, amount, created_at) VALUES (?, ?, ?, ?, ?)",
+			id, input.ChannelID, input.SenderID, input.Amount, time.Now(),
+		).Exec(ctx)
+
+		if err != nil {
+			return err
+		}
 
-	rows, err := res.RowsAffected()
+		message, err = insertMessage(ctx, tx, id, input)
+
+		if err != nil {
+			return err
+		}
+
+		sent = true
+		return nil
+	})
 
 	if err != nil {
-		return false, err
+		fmt.Println("Could not send flakes: ", err)
+		return nil, false, err
 	}
 
-	if rows > 0 {
-		db.updateFlakes(user_id, currentFlakes.Amount-amount)
-		return true, nil
+	if !sent {
+		message, err = db.GetTipMessage(input.ChannelID, input.SenderID, idempotency_key)
+		return message, false, err
 	}
 
-	return false, nil
+	message.Sender, _ = db.GetUser(input.SenderID)
+
+	return message, true, nil
 }
 
 func (db *BUN) GetFlakes(user_id string) (int, error) {
@@ -117,6 +213,22 @@ func (db *BUN) GetFlakes(user_id string) (int, error) {
 	return flakes.Amount, nil
 }
 
+func (db *BUN) GetFlakesLedger(user_id string, first int) ([]*model.FlakesLedgerEntry, error) {
+	var entries []*model.FlakesLedgerEntry
+
+	err := db.client.NewRaw(
+		"SELECT id, user_id, delta, balance, kind, reference_id, created_at FROM flakes_ledger WHERE user_id = ? ORDER BY created_at DESC LIMIT ?",
+		user_id, first,
+	).Scan(context.Background(), &entries)
+
+	if err != nil {
+		fmt.Println("Could not fetch flakes ledger: ", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
 func (db *BUN) GetChannelFlakes(channel_id string) ([]*model.ChannelFlakes, error) {
 	var channel_flakes []*model.ChannelFlakes
 
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/checkout/session"
+)
+
+var ErrPackNotFound = errors.New("Flakes pack not found")
+
+func (db *BUN) GetFlakesPacks() ([]*model.FlakesPack, error) {
+	var packs []*model.FlakesPack
+
+	err := db.client.NewRaw("SELECT * FROM flakes_packs WHERE is_active = true ORDER BY flakes ASC").Scan(context.Background(), &packs)
+
+	if err != nil {
+		fmt.Println("Could not fetch flakes packs: ", err)
+		return nil, err
+	}
+
+	return packs, nil
+}
+
+func (db *BUN) GetFlakesPack(id string) (*model.FlakesPack, error) {
+	var pack model.FlakesPack
+
+	err := db.client.NewRaw("SELECT * FROM flakes_packs WHERE id = ? AND is_active = true", id).Scan(context.Background(), &pack)
+
+	if err != nil {
+		return nil, ErrPackNotFound
+	}
+
+	return &pack, nil
+}
+
+// CreateFlakesCheckout opens a Stripe Checkout session for pack_id and returns
+// its id. Nothing is credited here, the Stripe webhook credits the Flakes once
+// the payment went through.
+func (db *BUN) CreateFlakesCheckout(user_id string, pack_id string) (string, error) {
+	pack, err := db.GetFlakesPack(pack_id)
+
+	if err != nil {
+		return "", err
+	}
+
+	user, err := db.GetUser(user_id)
+
+	if err != nil {
+		return "", err
+	}
+
+	customerID, err := db.stripeCustomer(user)
+
+	if err != nil {
+		return "", err
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	client_url := os.Getenv("CLIENT_URL")
+
+	params := &stripe.CheckoutSessionParams{
+		Customer:           stripe.String(customerID),
+		ClientReferenceID:  stripe.String(user_id),
+		Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Name:     stripe.String(pack.Name),
+				Amount:   stripe.Int64(int64(pack.PriceCents)),
+				Currency: stripe.String(pack.Currency),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		SuccessURL: stripe.String(client_url + "/flakes?checkout=success"),
+		CancelURL:  stripe.String(client_url + "/flakes?checkout=cancel"),
+	}
+	params.AddMetadata("kind", CheckoutFlakes)
+	params.AddMetadata("user_id", user_id)
+	params.AddMetadata("pack_id", pack.ID)
+	params.AddMetadata("flakes", strconv.Itoa(pack.Flakes))
+
+	s, err := session.New(params)
+
+	if err != nil {
+		fmt.Println("Could not create flakes checkout: ", err)
+		return "", err
+	}
+
+	_, err = db.CreatePayment(model.PaymentInput{UserID: user_id, OrderID: s.ID, Status: "pending"})
+
+	if err != nil {
+		return "", err
+	}
+
+	return s.ID, nil
+}
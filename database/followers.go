@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/uptrace/bun"
 )
 
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
 func (db *BUN) AddFollower(input model.FollowInput) (*model.Follower, error) {
 	var follow model.Follower
 
@@ -52,46 +55,39 @@ func (db *BUN) RemoveFollower(user_id string, follower_id string) (bool, error)
 	return false, nil
 }
 
+// GetFollowers pages through user_id's followers ordered by id. after is the
+// end cursor of the previous page.
 func (db *BUN) GetFollowers(user_id string, first int, after string) (*model.FollowersResult, error) {
 	var users []*model.User
-	var followers []*model.Follower
+
+	last := ""
 	if after != "" {
-		err := db.client.
-			NewRaw(
-				"SELECT u.* FROM ? u JOIN (SELECT user_id, follower_id from followers WHERE created_at > ? limit ?) as f ON f.follower_id = text(u.id) WHERE f.user_id = ?",
-				bun.Ident("users"), after, first, user_id).
-			Scan(context.Background(), &users)
+		decoded, err := base64.StdEncoding.DecodeString(after)
 		if err != nil {
-			fmt.Println("Could not get followers: ", err)
-		}
-	} else {
-		err := db.client.
-			NewRaw(
-				"SELECT u.* FROM ? u JOIN (SELECT user_id, follower_id from followers limit ?) as f ON f.follower_id = text(u.id) WHERE f.user_id = ?",
-				bun.Ident("users"), first, user_id).
-			Scan(context.Background(), &users)
-		if err != nil {
-			fmt.Println("Could not get followers: ", err)
+			return nil, ErrInvalidCursor
 		}
+		last = string(decoded)
 	}
 
-	var result *model.FollowersResult
-	var edges []*model.FollowersEdge
-	var pageInfo *model.PageInfo
+	err := db.client.
+		NewRaw(
+			"SELECT u.* FROM ? u JOIN followers f ON f.follower_id = text(u.id) WHERE f.user_id = ? AND f.follower_id > ? ORDER BY f.follower_id LIMIT ?",
+			bun.Ident("users"), user_id, last, first).
+		Scan(context.Background(), &users)
+	if err != nil {
+		fmt.Println("Could not get followers: ", err)
+		return nil, err
+	}
 
 	if len(users) == 0 {
-		pageInfo = &model.PageInfo{
-			EndCursor:   "",
-			HasNextPage: false,
-		}
-
-		result = &model.FollowersResult{
-			PageInfo: pageInfo,
+		return &model.FollowersResult{
+			PageInfo: &model.PageInfo{EndCursor: "", HasNextPage: false},
 			Edges:    []*model.FollowersEdge{},
-		}
-		return result, nil
+		}, nil
 	}
 
+	var edges []*model.FollowersEdge
+
 	for _, u := range users {
 		edges = append(edges, &model.FollowersEdge{
 			Cursor: base64.StdEncoding.EncodeToString([]byte(u.ID)),
@@ -99,31 +95,22 @@ func (db *BUN) GetFollowers(user_id string, first int, after string) (*model.Fol
 		})
 	}
 
-	var endCursor = users[len(users)-1].CreatedAt.String()
-	var hasNextPage bool
+	var followers []*model.Follower
 
-	count, err := db.client.NewSelect().Model(&followers).Where("user_id = ?", user_id).Where("created_at > ?", users[len(users)-1].CreatedAt).Count(context.Background())
+	count, err := db.client.NewSelect().Model(&followers).Where("user_id = ?", user_id).Where("follower_id > ?", users[len(users)-1].ID).Count(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not count remaining followers rows for pagination: ", err)
 		return nil, err
 	}
 
-	if count > 0 {
-		hasNextPage = true
-	}
-
-	pageInfo = &model.PageInfo{
-		EndCursor:   endCursor,
-		HasNextPage: hasNextPage,
-	}
-
-	result = &model.FollowersResult{
-		PageInfo: pageInfo,
-		Edges:    edges,
-	}
-
-	return result, nil
+	return &model.FollowersResult{
+		PageInfo: &model.PageInfo{
+			EndCursor:   edges[len(edges)-1].Cursor,
+			HasNextPage: count > 0,
+		},
+		Edges: edges,
+	}, nil
 }
 
 func (db *BUN) GetFollowing(follower_id string, first int, after string) (*model.FollowersResult, error) {
@@ -201,6 +188,19 @@ func (db *BUN) GetFollowing(follower_id string, first int, after string) (*model
 
 }
 
+func (db *BUN) GetFollowerIDs(user_id string) ([]string, error) {
+	var ids []string
+
+	err := db.client.NewRaw("SELECT follower_id FROM followers WHERE user_id = ?", user_id).Scan(context.Background(), &ids)
+
+	if err != nil {
+		fmt.Println("Could not get follower ids: ", err)
+		return nil, err
+	}
+
+	return ids, nil
+}
+
 func (db *BUN) CountFollowers(user_id string) (int, error) {
 	var follower []*model.Follower
 	count, err := db.client.NewSelect().Model(&follower).Where("user_id = ?", user_id).ScanAndCount(context.Background())
@@ -226,6 +226,18 @@ func (db *BUN) CountFollowing(follower_id string) (int, error) {
 	return count, nil
 }
 
+func (db *BUN) GetFollow(user_id string, follower_id string) (*model.Follower, error) {
+	var follower model.Follower
+
+	err := db.client.NewSelect().Model(&follower).Where("user_id = ? AND follower_id = ?", user_id, follower_id).Scan(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &follower, nil
+}
+
 func (db *BUN) IsFollowing(user_id string, follower_id string) (bool, error) {
 	var follower model.Follower
 
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/checkout/session"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+const (
+	CheckoutGift = "gift"
+
+	maxGifts     = 50
+	giftDuration = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidGiftCount = errors.New("You can gift between 1 and 50 memberships")
+	ErrGiftRecipients   = errors.New("The number of recipients must match the number of gifts")
+)
+
+// MembershipGift is a fulfilled gift of memberships.
+type MembershipGift struct {
+	ID         string
+	GifterID   string
+	ChannelID  string
+	Tier       string
+	Count      int
+	Recipients []*model.User
+	// Unassigned is how many of the paid memberships found no recipient.
+	Unassigned int
+}
+
+// CreateGiftCheckout opens a Stripe Checkout session that charges gifter_id
+// once for count memberships of tier. The memberships are handed out by
+// FulfillGift after the payment went through.
+func (db *BUN) CreateGiftCheckout(gifter_id string, channel_id string, tier int, count int, recipient_ids []string) (string, error) {
+	if count < 1 || count > maxGifts {
+		return "", ErrInvalidGiftCount
+	}
+
+	if len(recipient_ids) > 0 && len(recipient_ids) != count {
+		return "", ErrGiftRecipients
+	}
+
+	for _, recipient_id := range recipient_ids {
+		if recipient_id == channel_id {
+			return "", ErrOwnChannel
+		}
+
+		if _, err := db.GetUser(recipient_id); err != nil {
+			return "", fmt.Errorf("Unknown recipient %s", recipient_id)
+		}
+	}
+
+	price, err := db.getMembershipPrice(channel_id, tier)
+
+	if err != nil || price.PriceCents == 0 {
+		return "", ErrTierNotForSale
+	}
+
+	gifter, err := db.GetUser(gifter_id)
+
+	if err != nil {
+		return "", err
+	}
+
+	customerID, err := db.stripeCustomer(gifter)
+
+	if err != nil {
+		return "", err
+	}
+
+	giftID := uuid.New().String()
+	tierID := strconv.Itoa(tier)
+
+	_, err = db.client.NewRaw(
+		"INSERT INTO membership_gifts (id, gifter_id, channel_id, tier, count, requested_ids, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		giftID, gifter_id, channel_id, tierID, count, pgdialect.Array(recipient_ids), time.Now(),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not create gift: ", err)
+		return "", err
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	client_url := os.Getenv("CLIENT_URL")
+
+	params := &stripe.CheckoutSessionParams{
+		Customer:           stripe.String(customerID),
+		ClientReferenceID:  stripe.String(gifter_id),
+		Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Name:     stripe.String("Gifted " + price.Name + " membership"),
+				Amount:   stripe.Int64(int64(price.PriceCents)),
+				Currency: stripe.String(price.Currency),
+				Quantity: stripe.Int64(int64(count)),
+			},
+		},
+		SuccessURL: stripe.String(client_url + "/" + channel_id + "?gift=success"),
+		CancelURL:  stripe.String(client_url + "/" + channel_id + "?gift=cancel"),
+	}
+	params.AddMetadata("kind", CheckoutGift)
+	params.AddMetadata("user_id", gifter_id)
+	params.AddMetadata("channel_id", channel_id)
+	params.AddMetadata("tier", tierID)
+	params.AddMetadata("gift_id", giftID)
+
+	s, err := session.New(params)
+
+	if err != nil {
+		fmt.Println("Could not create gift checkout: ", err)
+		return "", err
+	}
+
+	_, err = db.client.NewRaw("UPDATE membership_gifts SET session_id = ? WHERE id = ?", s.ID, giftID).Exec(context.Background())
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.CreatePayment(model.PaymentInput{UserID: gifter_id, OrderID: s.ID, Status: "pending"})
+
+	if err != nil {
+		return "", err
+	}
+
+	return s.ID, nil
+}
+
+// giftRecipients picks count random viewers in chat that are not already
+// members of the channel.
+func (db *BUN) giftRecipients(ctx context.Context, tx bun.Tx, gifter_id string, channel_id string, count int) ([]string, error) {
+	var candidates []string
+
+	err := tx.NewRaw(
+		"SELECT DISTINCT cu.user_id FROM chat_users cu WHERE cu.channel_id = ? AND cu.last_seen_at >= ? AND cu.user_id NOT IN (?, ?) AND NOT EXISTS (SELECT 1 FROM memberships m WHERE m.user_id = cu.user_id AND m.channel_id = cu.channel_id AND m.is_active = true AND (m.expires_at IS NULL OR m.expires_at > ?))",
+		channel_id, presenceCutoff(), gifter_id, channel_id, time.Now(),
+	).Scan(ctx, &candidates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+
+	return candidates, nil
+}
+
+// FulfillGift hands out the memberships of a paid gift. fulfilled is false when
+// the gift was handed out before, so it is only announced once.
+func (db *BUN) FulfillGift(gift_id string) (gift *MembershipGift, fulfilled bool, err error) {
+	ctx := context.Background()
+	gift = &MembershipGift{ID: gift_id}
+
+	var recipient_ids []string
+
+	err = db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var status string
+		var requested []string
+
+		err := tx.NewRaw(
+			"SELECT gifter_id, channel_id, tier, count, status, requested_ids FROM membership_gifts WHERE id = ? FOR UPDATE",
+			gift_id,
+		).Scan(ctx, &gift.GifterID, &gift.ChannelID, &gift.Tier, &gift.Count, &status, pgdialect.Array(&requested))
+
+		if err != nil {
+			return err
+		}
+
+		if status == "fulfilled" {
+			return nil
+		}
+
+		recipient_ids = requested
+
+		if len(recipient_ids) == 0 {
+			recipient_ids, err = db.giftRecipients(ctx, tx, gift.GifterID, gift.ChannelID, gift.Count)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+
+		for _, recipient_id := range recipient_ids {
+			_, err = tx.NewRaw(
+				"INSERT INTO memberships (id, channel_id, user_id, gifter, is_gift, is_active, status, tier, expires_at, gift_id, created_at, updated_at) VALUES (?, ?, ?, ?, true, true, ?, ?, ?, ?, ?, ?)",
+				uuid.New().String(), gift.ChannelID, recipient_id, gift.GifterID, MembershipActive, gift.Tier, now.Add(giftDuration), gift_id, now, now,
+			).Exec(ctx)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		// gifts nobody in chat could receive stay on the gift for support to
+		// refund or hand out.
+		if len(recipient_ids) < gift.Count {
+			gift.Unassigned = gift.Count - len(recipient_ids)
+		}
+
+		_, err = tx.NewRaw(
+			"UPDATE membership_gifts SET status = 'fulfilled', unassigned = ?, fulfilled_at = ? WHERE id = ?",
+			gift.Unassigned, now, gift_id,
+		).Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		fulfilled = true
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println("Could not fulfill gift: ", err)
+		return nil, false, err
+	}
+
+	for _, recipient_id := range recipient_ids {
+		if user, err := db.GetUser(recipient_id); err == nil {
+			gift.Recipients = append(gift.Recipients, user)
+		}
+	}
+
+	return gift, fulfilled, nil
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Video job states reported by the Mux webhook.
+const (
+	VideoJobRecording = "recording"
+	VideoJobReady     = "ready"
+	VideoJobErrored   = "errored"
+)
+
+var ErrInvalidJobStatus = errors.New("Unknown video job status")
+
+// ValidVideoJobStatus reports whether status is one of the video job states.
+func ValidVideoJobStatus(status string) bool {
+	switch status {
+	case VideoJobRecording, VideoJobReady, VideoJobErrored:
+		return true
+	}
+
+	return false
+}
+
+// MuxAsset is an asset Mux finished processing. LiveStreamID is set for
+// recordings of a live stream.
+type MuxAsset struct {
+	ID             string
+	LiveStreamID   string
+	PlaybackID     string
+	PlaybackPolicy model.PlaybackPolicy
+}
+
+// MuxEventStore applies the effects of a Mux event. The one handed out by
+// ProcessMuxEvent works inside the event's transaction.
+type MuxEventStore interface {
+	SetChannelLive(livestream_id string, live bool, at time.Time) (string, error)
+	CreateRecording(livestream_id string, asset_id string) error
+	AssetReady(asset MuxAsset) error
+	CreateVideoJob(job_id string, status string) (string, error)
+}
+
+// ProcessMuxEvent claims the event id and runs apply in the same transaction,
+// so the event is recorded exactly when its effects are. It returns false
+// without calling apply when the event was claimed before.
+func (db *BUN) ProcessMuxEvent(id string, kind string, apply func(store MuxEventStore) error) (bool, error) {
+	ctx := context.Background()
+	claimed := false
+
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var claimedID string
+
+		err := tx.NewRaw(
+			"INSERT INTO mux_events (id, type, processed_at) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING RETURNING id",
+			id, kind, time.Now(),
+		).Scan(ctx, &claimedID)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := apply(&BUN{client: tx}); err != nil {
+			return err
+		}
+
+		claimed = true
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println("Could not process mux event: ", err)
+		return false, err
+	}
+
+	return claimed, nil
+}
+
+// SetChannelLive stores whether the channel streaming to livestream_id is
+// live and returns the channel's id when it just went live. Mux does not
+// deliver events in order, so an idle event older than the latest active one
+// is ignored.
+func (db *BUN) SetChannelLive(livestream_id string, live bool, at time.Time) (string, error) {
+	if !live {
+		_, err := db.client.NewRaw(
+			"UPDATE channels SET is_live = false, updated_at = ? WHERE livestream_id = ? AND (went_live_at IS NULL OR went_live_at <= ?)",
+			time.Now(), livestream_id, at,
+		).Exec(context.Background())
+
+		if err != nil {
+			fmt.Println("Could not update channel live state: ", err)
+			return "", err
+		}
+
+		return "", nil
+	}
+
+	var channel_id string
+
+	err := db.client.NewRaw(
+		"UPDATE channels SET is_live = true, went_live_at = ?, updated_at = ? WHERE livestream_id = ? AND (went_live_at IS NULL OR went_live_at < ?) RETURNING user_id",
+		at, time.Now(), livestream_id, at,
+	).Scan(context.Background(), &channel_id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		fmt.Println("Could not update channel live state: ", err)
+		return "", err
+	}
+
+	return channel_id, nil
+}
+
+// CreateRecording adds a hidden video for the asset a live stream is being
+// recorded to. The asset id doubles as the video's job id.
+func (db *BUN) CreateRecording(livestream_id string, asset_id string) error {
+	now := time.Now()
+
+	_, err := db.client.NewRaw(
+		"INSERT INTO videos (id, channel_id, title, job_id, asset_id, is_premium, is_visible, created_at, updated_at) "+
+			"SELECT ?, user_id, COALESCE(NULLIF(title, ''), 'Past broadcast'), ?, ?, false, false, ?, ? FROM channels WHERE livestream_id = ? "+
+			"ON CONFLICT (asset_id) DO NOTHING",
+		uuid.New().String(), asset_id, asset_id, now, now, livestream_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not create recording: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// AssetReady attaches the asset's playback id to its video. Uploads are
+// matched by the job id they were created with, recordings that missed their
+// recording event are created here.
+func (db *BUN) AssetReady(asset MuxAsset) error {
+	if asset.LiveStreamID != "" {
+		if err := db.CreateRecording(asset.LiveStreamID, asset.ID); err != nil {
+			return err
+		}
+	}
+
+	policy := asset.PlaybackPolicy
+	if policy == "" {
+		policy = model.PlaybackPolicyPublic
+	}
+
+	_, err := db.client.NewRaw(
+		"UPDATE videos SET asset_id = ?, playback_id = ?, playback_policy = ?, media = ?, thumbnail = COALESCE(NULLIF(thumbnail, ''), ?), updated_at = ? WHERE asset_id = ? OR (asset_id IS NULL AND job_id = ?)",
+		asset.ID, asset.PlaybackID, policy,
+		"https://stream.mux.com/"+asset.PlaybackID+".m3u8",
+		"https://image.mux.com/"+asset.PlaybackID+"/thumbnail.jpg",
+		time.Now(), asset.ID, asset.ID,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not attach asset to video: ", err)
+		return err
+	}
+
+	return nil
+}
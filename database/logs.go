@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/glitchd/glitchd-server/graph/model"
 	"github.com/google/uuid"
 )
 
@@ -23,3 +24,16 @@ func (db *BUN) CreateLog(data string) (bool, error) {
 
 	return true, nil
 }
+
+func (db *BUN) GetLogs(first int) ([]*model.Logs, error) {
+	var logs []*model.Logs
+
+	err := db.client.NewRaw("SELECT * FROM logs ORDER BY created_at DESC LIMIT ?", first).Scan(context.Background(), &logs)
+
+	if err != nil {
+		fmt.Println("Error fetching logs: ", err)
+		return nil, err
+	}
+
+	return logs, nil
+}
@@ -2,7 +2,6 @@ package database
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/glitchd/glitchd-server/graph/model"
@@ -11,6 +10,11 @@ import (
 )
 
 func (db *BUN) CreateMembershipDetails(input model.MembershipDetailsInput) (bool, error) {
+	price_cents, err := parseCents(input.Cost)
+
+	if err != nil {
+		return false, err
+	}
 
 	id := uuid.New().String()
 	now := time.Now()
@@ -30,22 +34,29 @@ func (db *BUN) CreateMembershipDetails(input model.MembershipDetailsInput) (bool
 		return false, err
 	}
 
-	if rows > 0 {
-		return true, nil
+	if rows == 0 {
+		return false, nil
 	}
 
-	return false, nil
+	if err := db.syncMembershipPrice(input.ChannelID, input.Tier, price_cents); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 func (db *BUN) CreateMembership(input model.NewMembership) (*model.Membership, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	fmt.Println("isActive: ", input.IsActive)
+	status := MembershipActive
+	if !input.IsActive {
+		status = MembershipCancelled
+	}
 
 	res, err := db.client.NewRaw(
-		"INSERT INTO ? (id, channel_id, user_id, gifter, is_gift, is_active, tier, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		bun.Ident("memberships"), id, input.ChannelID, input.UserID, input.GifterID, input.IsGift, input.IsActive, input.Tier, now, now,
+		"INSERT INTO ? (id, channel_id, user_id, gifter, is_gift, is_active, status, tier, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		bun.Ident("memberships"), id, input.ChannelID, input.UserID, input.GifterID, input.IsGift, input.IsActive, status, input.Tier, now, now,
 	).Exec(context.Background())
 
 	if err != nil {
@@ -96,9 +107,14 @@ func (db *BUN) UpdateMembership(id string, input model.NewMembership) (bool, err
 func (db *BUN) UpdateMembershipStatus(id string, is_active bool) (bool, error) {
 	now := time.Now()
 
+	status := MembershipActive
+	if !is_active {
+		status = MembershipCancelled
+	}
+
 	row, err := db.client.NewRaw(
-		"UPDATE memberships SET is_active = ?, updated_at = ? WHERE id = ?",
-		is_active, now, id,
+		"UPDATE memberships SET is_active = ?, status = ?, updated_at = ? WHERE id = ?",
+		is_active, status, now, id,
 	).Exec(context.Background())
 	if err != nil {
 		return false, err
@@ -132,7 +148,7 @@ func (db *BUN) GetMembershipById(id string) (*model.Membership, error) {
 func (db *BUN) GetUserMembership(user_id string, channel_id string) ([]*model.Membership, error) {
 	var result []*model.Membership
 
-	err := db.client.NewRaw("SELECT * FROM memberships WHERE user_id = ? AND channel_id = ? AND is_active = 'true'", user_id, channel_id).Scan(context.Background(), &result)
+	err := db.client.NewRaw("SELECT * FROM memberships WHERE user_id = ? AND channel_id = ? AND "+membershipValid, user_id, channel_id, time.Now()).Scan(context.Background(), &result)
 
 	if err != nil {
 		return nil, err
@@ -144,7 +160,7 @@ func (db *BUN) GetUserMembership(user_id string, channel_id string) ([]*model.Me
 func (db *BUN) GetChannelMemberships(channel_id string) ([]*model.Membership, error) {
 	var result []*model.Membership
 
-	err := db.client.NewRaw("SELECT * FROM memberships WHERE channel_id = ? AND is_active = 'true'", channel_id).Scan(context.Background(), &result)
+	err := db.client.NewRaw("SELECT * FROM memberships WHERE channel_id = ? AND "+membershipValid, channel_id, time.Now()).Scan(context.Background(), &result)
 
 	if err != nil {
 		return nil, err
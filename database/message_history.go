@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+)
+
+const maxMessagesPage = 100
+
+// messageCursor encodes a message's position in the newest first order chat
+// history is paged in. The id breaks ties between messages sent in the same
+// instant.
+func messageCursor(message *model.Message) string {
+	return base64.StdEncoding.EncodeToString([]byte(message.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + message.ID))
+}
+
+func decodeMessageCursor(cursor string) (time.Time, string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	created, id, found := strings.Cut(string(decoded), ",")
+	if !found {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+// pageMessages returns up to first messages matching where that were sent
+// before the cursor, newest first.
+func (db *BUN) pageMessages(where string, args []interface{}, first int, before string) ([]*model.Message, bool, error) {
+	if first < 1 || first > maxMessagesPage {
+		first = maxMessagesPage
+	}
+
+	if before != "" {
+		createdAt, id, err := decodeMessageCursor(before)
+		if err != nil {
+			return nil, false, err
+		}
+
+		where += " AND (created_at, id) < (?, ?::uuid)"
+		args = append(args, createdAt, id)
+	}
+
+	var messages []*model.Message
+
+	// one extra row tells whether there is another page.
+	err := db.client.NewRaw(
+		"SELECT * FROM messages WHERE "+where+" ORDER BY created_at DESC, id DESC LIMIT ?",
+		append(args, first+1)...,
+	).Scan(context.Background(), &messages)
+
+	if err != nil {
+		fmt.Println("Could not fetch messages: ", err)
+		return nil, false, err
+	}
+
+	hasNextPage := len(messages) > first
+	if hasNextPage {
+		messages = messages[:first]
+	}
+
+	for _, message := range messages {
+		message.Sender, _ = db.GetUser(message.SenderID)
+	}
+
+	if err := db.loadMessageDetails(messages); err != nil {
+		return nil, false, err
+	}
+
+	return messages, hasNextPage, nil
+}
+
+// messagesResult builds the page, endCursor points at the oldest message.
+func messagesResult(messages []*model.Message, oldest *model.Message, hasNextPage bool) *model.MessagesResult {
+	edges := make([]*model.MessagesEdge, 0, len(messages))
+
+	for _, message := range messages {
+		edges = append(edges, &model.MessagesEdge{Cursor: messageCursor(message), Node: message})
+	}
+
+	pageInfo := &model.PageInfo{EndCursor: "", HasNextPage: hasNextPage}
+	if oldest != nil {
+		pageInfo.EndCursor = messageCursor(oldest)
+	}
+
+	return &model.MessagesResult{Edges: edges, PageInfo: pageInfo}
+}
+
+// historyResult puts a newest first page back in the order it was sent.
+func historyResult(messages []*model.Message, hasNextPage bool) *model.MessagesResult {
+	var oldest *model.Message
+	if len(messages) > 0 {
+		oldest = messages[len(messages)-1]
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messagesResult(messages, oldest, hasNextPage)
+}
+
+// GetMessages pages back through the chat of channel_id. Each page is in the
+// order it was sent.
+func (db *BUN) GetMessages(channel_id string, before string, first int) (*model.MessagesResult, error) {
+	messages, hasNextPage, err := db.pageMessages("channel_id = ? AND is_deleted = false", []interface{}{channel_id}, first, before)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return historyResult(messages, hasNextPage), nil
+}
+
+// GetMessageReplies pages back through the replies to message_id.
+func (db *BUN) GetMessageReplies(message_id string, before string, first int) (*model.MessagesResult, error) {
+	messages, hasNextPage, err := db.pageMessages("reply_parent_message_id = ? AND is_deleted = false", []interface{}{message_id}, first, before)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return historyResult(messages, hasNextPage), nil
+}
+
+// SearchMessages finds messages in the chat of channel_id for moderators.
+// Deleted messages are included so they can be reviewed.
+func (db *BUN) SearchMessages(channel_id string, filter model.MessageSearchInput, before string, first int) (*model.MessagesResult, error) {
+	where := "channel_id = ?"
+	args := []interface{}{channel_id}
+
+	if query := strings.TrimSpace(stringOrEmpty(filter.Query)); query != "" {
+		where += " AND to_tsvector('simple', message) @@ websearch_to_tsquery('simple', ?)"
+		args = append(args, query)
+	}
+
+	if sender := strings.TrimSpace(stringOrEmpty(filter.Sender)); sender != "" {
+		where += " AND (sender_id = ? OR sender_id IN (SELECT text(id) FROM users WHERE lower(username) = lower(?)))"
+		args = append(args, sender, sender)
+	}
+
+	if filter.Since != nil {
+		where += " AND created_at >= ?"
+		args = append(args, *filter.Since)
+	}
+
+	if filter.Until != nil {
+		where += " AND created_at < ?"
+		args = append(args, *filter.Until)
+	}
+
+	messages, hasNextPage, err := db.pageMessages(where, args, first, before)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var oldest *model.Message
+	if len(messages) > 0 {
+		oldest = messages[len(messages)-1]
+	}
+
+	return messagesResult(messages, oldest, hasNextPage), nil
+}
+
+func stringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -10,56 +10,74 @@ import (
 	"github.com/uptrace/bun"
 )
 
-func (db *BUN) CreateMessage(input *model.NewMessage) (*model.Message, error) {
-	var message model.Message
+// CreateMessage posts input. With slow set, as returned by CheckChatModes, the
+// sender's last message is checked in the same transaction as the insert.
+func (db *BUN) CreateMessage(input *model.NewMessage, slow time.Duration) (*model.Message, error) {
+	var message *model.Message
 
-	var now = time.Now()
+	ctx := context.Background()
 	id := uuid.New().String()
 
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if slow > 0 {
+			if err := checkSlowMode(ctx, tx, input.ChannelID, input.SenderID, slow); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		message, err = insertMessage(ctx, tx, id, input)
+		return err
+	})
+
+	if err != nil {
+		fmt.Println("Error found when following user: ", err)
+		return nil, err
+	}
+
 	user, err := db.GetUser(input.SenderID)
 
 	if err != nil {
 		fmt.Println("user could not be fetched in messages: ", err)
 	}
 
-	message.ID = id
 	message.Sender = user
-	message.ChannelID = input.ChannelID
-	message.IsSent = input.IsSent
-	message.Message = input.Message
-	message.MessageType = input.MessageType
-	message.Amount = input.Amount
-	message.ReplyParentMessageID = input.ReplyParentMessageID
-	message.CreatedAt = now
-	message.UpdatedAt = now
 
-	res, err := db.client.NewRaw(
-		"INSERT INTO ? (id, sender_id, channel_id, is_sent, message, message_type, amount, drop_code, drop_message, reply_parent_message_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		bun.Ident("messages"), id, input.SenderID, input.ChannelID, input.IsSent, input.Message, input.MessageType, input.Amount, "", "", input.ReplyParentMessageID,
-	).Exec(context.Background())
+	return message, nil
+}
 
-	if err != nil {
-		fmt.Println("Error found when following user: ", err)
-		return nil, err
-	}
+// insertMessage stores input as message id through idb, which may be a
+// transaction.
+func insertMessage(ctx context.Context, idb bun.IDB, id string, input *model.NewMessage) (*model.Message, error) {
+	var now = time.Now()
 
-	affected, err := res.RowsAffected()
+	_, err := idb.NewRaw(
+		"INSERT INTO ? (id, sender_id, channel_id, is_sent, message, message_type, amount, drop_code, drop_message, reply_parent_message_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		bun.Ident("messages"), id, input.SenderID, input.ChannelID, input.IsSent, input.Message, input.MessageType, input.Amount, "", "", input.ReplyParentMessageID, now, now,
+	).Exec(ctx)
 
 	if err != nil {
-		fmt.Println("Error when detecting affected rows: ", err)
-	}
-
-	if affected > 0 {
-		return &message, nil
+		return nil, err
 	}
 
-	return &message, nil
+	return &model.Message{
+		ID:                   id,
+		ChannelID:            input.ChannelID,
+		SenderID:             input.SenderID,
+		IsSent:               input.IsSent,
+		Message:              input.Message,
+		MessageType:          input.MessageType,
+		Amount:               input.Amount,
+		ReplyParentMessageID: input.ReplyParentMessageID,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}, nil
 }
 
 func (db *BUN) GetRecentMessages(channelID string) ([]*model.Message, error) {
 	var messages []*model.Message
 	err := db.client.NewRaw(
-		"SELECT msg.* FROM (SELECT * FROM ? WHERE channel_id = ? ORDER BY created_at DESC LIMIT 50) msg ORDER BY created_at ASC",
+		"SELECT msg.* FROM (SELECT * FROM ? WHERE channel_id = ? AND is_deleted = false ORDER BY created_at DESC LIMIT 50) msg ORDER BY created_at ASC",
 		bun.Ident("messages"), channelID).Scan(context.Background(), &messages)
 
 	for index, message := range messages {
@@ -71,6 +89,11 @@ func (db *BUN) GetRecentMessages(channelID string) ([]*model.Message, error) {
 		fmt.Println("Could not fetch post: ", err)
 		return nil, err
 	}
+
+	if err := db.loadMessageDetails(messages); err != nil {
+		return nil, err
+	}
+
 	return messages, nil
 }
 
@@ -125,52 +148,41 @@ func (db *BUN) UpdateChatIdentity(user_id string, input model.ChatIdentityInput)
 	return true, nil
 }
 
+// IsUserInChat reports whether user_id is present in the chat of channel_id.
 func (db *BUN) IsUserInChat(channel_id string, user_id string) (bool, error) {
-	var users model.UsersInChat
+	var present bool
 
 	err := db.client.NewRaw(
-		"SELECT * FROM chat_users WHERE channel_id = ? AND user_id = ?",
-		channel_id, user_id,
-	).Scan(context.Background(), &users)
+		"SELECT EXISTS (SELECT 1 FROM chat_users WHERE channel_id = ? AND user_id = ? AND last_seen_at >= ?)",
+		channel_id, user_id, presenceCutoff(),
+	).Scan(context.Background(), &present)
 
 	if err != nil {
 		return false, err
 	}
 
-	return true, nil
+	return present, nil
 }
 
+// AddUserInChat lists user_id in the chat of channel_id, or refreshes their
+// presence when they are listed already. Calling it again is the heartbeat. It
+// reports whether they just joined, that is were not listed or had expired.
 func (db *BUN) AddUserInChat(channel_id string, user_id string) (bool, error) {
-	id := uuid.New().String()
-
-	isIn, _ := db.IsUserInChat(channel_id, user_id)
+	var joined bool
+	cutoff := presenceCutoff()
 
-	if isIn {
-		return true, nil
-	}
-
-	res, err := db.client.NewRaw(
-		"INSERT INTO chat_users (id, user_id, channel_id) VALUES (?, ?, ?)",
-		id, user_id, channel_id,
-	).Exec(context.Background())
+	// prev still sees the row as it was before the upsert.
+	err := db.client.NewRaw(
+		"WITH prev AS (SELECT last_seen_at FROM chat_users WHERE channel_id = ? AND user_id = ?), up AS (INSERT INTO chat_users AS p (id, user_id, channel_id, connections, last_seen_at) VALUES (?, ?, ?, 1, ?) ON CONFLICT (channel_id, user_id) DO UPDATE SET connections = CASE WHEN p.last_seen_at < ? THEN 1 ELSE p.connections END, last_seen_at = EXCLUDED.last_seen_at RETURNING 1) SELECT NOT EXISTS (SELECT 1 FROM prev WHERE last_seen_at >= ?) FROM up",
+		channel_id, user_id, uuid.New().String(), user_id, channel_id, time.Now(), cutoff, cutoff,
+	).Scan(context.Background(), &joined)
 
 	if err != nil {
 		fmt.Println("Could not insert users in chat: ", err)
 		return false, err
 	}
 
-	rows, err := res.RowsAffected()
-
-	if err != nil {
-		fmt.Println("Could not get affected rows in users in chat")
-		return false, err
-	}
-
-	if rows > 0 {
-		return true, nil
-	}
-
-	return true, nil
+	return joined, nil
 }
 
 func (db *BUN) DeleteUserInChat(channel_id string, user_id string) (bool, error) {
@@ -203,8 +215,8 @@ func (db *BUN) GetUsersInChat(channel_id string) ([]*model.User, error) {
 	var users []*model.User
 
 	err := db.client.NewRaw(
-		"SELECT u.* FROM users u JOIN (SELECT * FROM chat_users WHERE channel_id = ? LIMIT 50) as cu ON text(u.id) = cu.user_id",
-		channel_id,
+		"SELECT u.* FROM users u JOIN (SELECT * FROM chat_users WHERE channel_id = ? AND last_seen_at >= ? ORDER BY last_seen_at DESC LIMIT 50) as cu ON text(u.id) = cu.user_id",
+		channel_id, presenceCutoff(),
 	).Scan(context.Background(), &users)
 
 	if err != nil {
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrBanned          = errors.New("You are banned from this chat")
+	ErrTimedOut        = errors.New("You are timed out in this chat")
+	ErrCannotModerate  = errors.New("The channel owner and its moderators cannot be banned")
+	ErrMessageNotFound = errors.New("Message not found")
+)
+
+// BanUser bans user_id from the channel chat. A nil expires_at bans them until
+// unbanned, otherwise the ban works as a timeout. The owner can't be banned,
+// and its moderators and admins only by the owner or an admin.
+func (db *BUN) BanUser(channel_id string, user_id string, moderator_id string, reason string, expires_at *time.Time) (bool, error) {
+	if channel_id == user_id {
+		return false, ErrCannotModerate
+	}
+
+	// moderators and admins can only be banned by the owner or an admin.
+	staff, err := db.HasRole(user_id, model.RoleModerator, channel_id)
+
+	if err != nil {
+		return false, err
+	}
+
+	if staff && moderator_id != channel_id {
+		admin, err := db.HasRole(moderator_id, model.RoleAdmin, "")
+
+		if err != nil {
+			return false, err
+		}
+
+		if !admin {
+			return false, ErrCannotModerate
+		}
+	}
+
+	_, err = db.client.NewRaw(
+		"INSERT INTO channel_bans (id, channel_id, user_id, moderator_id, reason, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (channel_id, user_id) DO UPDATE SET moderator_id=EXCLUDED.moderator_id, reason=EXCLUDED.reason, expires_at=EXCLUDED.expires_at, created_at=EXCLUDED.created_at",
+		uuid.New().String(), channel_id, user_id, moderator_id, reason, expires_at, time.Now(),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not ban user: ", err)
+		return false, err
+	}
+
+	db.DeleteUserInChat(channel_id, user_id)
+
+	return true, nil
+}
+
+func (db *BUN) UnbanUser(channel_id string, user_id string) (bool, error) {
+	res, err := db.client.NewRaw(
+		"DELETE FROM channel_bans WHERE channel_id = ? AND user_id = ?",
+		channel_id, user_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not unban user: ", err)
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	if rows > 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// CheckBan returns ErrBanned or ErrTimedOut while user_id is not allowed to
+// take part in the channel chat.
+func (db *BUN) CheckBan(channel_id string, user_id string) error {
+	var ban model.ChannelBan
+
+	err := db.client.NewRaw(
+		"SELECT * FROM channel_bans WHERE channel_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)",
+		channel_id, user_id, time.Now(),
+	).Scan(context.Background(), &ban)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		fmt.Println("Could not check channel ban: ", err)
+		return err
+	}
+
+	if ban.ExpiresAt != nil {
+		return ErrTimedOut
+	}
+
+	return ErrBanned
+}
+
+func (db *BUN) GetChannelBans(channel_id string) ([]*model.ChannelBan, error) {
+	var bans []*model.ChannelBan
+
+	err := db.client.NewRaw(
+		"SELECT * FROM channel_bans WHERE channel_id = ? AND (expires_at IS NULL OR expires_at > ?) ORDER BY created_at DESC",
+		channel_id, time.Now(),
+	).Scan(context.Background(), &bans)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for index, ban := range bans {
+		user, _ := db.GetUser(ban.UserID)
+		bans[index].User = user
+	}
+
+	return bans, nil
+}
+
+func (db *BUN) DeleteMessage(channel_id string, message_id string, moderator_id string) (*model.Message, error) {
+	var message model.Message
+	now := time.Now()
+
+	err := db.client.NewRaw(
+		"UPDATE messages SET is_deleted = true, deleted_by = ?, deleted_at = ?, updated_at = ? WHERE id = ? AND channel_id = ? RETURNING *",
+		moderator_id, now, now, message_id, channel_id,
+	).Scan(context.Background(), &message)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+
+	if err != nil {
+		fmt.Println("Could not delete message: ", err)
+		return nil, err
+	}
+
+	user, _ := db.GetUser(message.SenderID)
+	message.Sender = user
+
+	if err := db.loadMessageDetails([]*model.Message{&message}); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/uptrace/bun"
+)
+
+// NotificationTarget is how a follower wants to hear about channels going
+// live.
+type NotificationTarget struct {
+	UserID     string `bun:"id"`
+	Email      string `bun:"email"`
+	PushToken  string `bun:"mobile_push_token"`
+	EmailOptIn bool   `bun:"live_email_notifications"`
+}
+
+func (db *BUN) GetUserDetails(id string) (*model.UserDetails, error) {
+	var details model.UserDetails
+
+	err := db.client.NewRaw(
+		"SELECT COALESCE(mobile_push_token, '') AS mobile_push_token, live_email_notifications FROM users WHERE id = ?", id,
+	).Scan(context.Background(), &details)
+
+	if err != nil {
+		fmt.Println("Could not fetch user details: ", err)
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+func (db *BUN) UpdateUserDetails(id string, input model.UserDetailsInput) (*model.UserDetails, error) {
+	_, err := db.client.NewRaw(
+		"UPDATE users SET mobile_push_token = NULLIF(?, ''), live_email_notifications = ?, updated_at = ? WHERE id = ?",
+		input.MobilePushToken, input.LiveEmailNotifications, time.Now(), id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not update user details: ", err)
+		return nil, err
+	}
+
+	return &model.UserDetails{MobilePushToken: input.MobilePushToken, LiveEmailNotifications: input.LiveEmailNotifications}, nil
+}
+
+// ClaimLiveNotification reports whether followers of channel_id should be
+// told it went live. Streams that reconnect within cooldown are only
+// announced once.
+func (db *BUN) ClaimLiveNotification(channel_id string, cooldown time.Duration) (bool, error) {
+	now := time.Now()
+
+	res, err := db.client.NewRaw(
+		"UPDATE channels SET live_notified_at = ? WHERE user_id = ? AND (live_notified_at IS NULL OR live_notified_at < ?)",
+		now, channel_id, now.Add(-cooldown),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not claim live notification: ", err)
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// NotificationTargets returns the push token and email preference of every
+// user in user_ids.
+func (db *BUN) NotificationTargets(user_ids []string) ([]NotificationTarget, error) {
+	var targets []NotificationTarget
+
+	if len(user_ids) == 0 {
+		return targets, nil
+	}
+
+	err := db.client.NewRaw(
+		"SELECT text(id) AS id, email, COALESCE(mobile_push_token, '') AS mobile_push_token, live_email_notifications FROM users WHERE text(id) IN (?)",
+		bun.In(user_ids),
+	).Scan(context.Background(), &targets)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not fetch notification targets: ", err)
+		return nil, err
+	}
+
+	return targets, nil
+}
@@ -16,8 +16,8 @@ func (db *BUN) CreatePayment(input model.PaymentInput) (bool, error) {
 	now := time.Now()
 
 	res, err := db.client.NewRaw(
-		"INSERT INTO ? (id, user_id, order_id, status, created_at) VALUES (?, ?, ?, ?, ?)",
-		bun.Ident("payments"), id, input.UserID, input.OrderID, input.Status, now,
+		"INSERT INTO ? (id, user_id, order_id, session_id, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		bun.Ident("payments"), id, input.UserID, input.OrderID, input.OrderID, input.Status, now,
 	).Exec(context.Background())
 
 	if err != nil {
@@ -0,0 +1,369 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/account"
+	"github.com/stripe/stripe-go/accountlink"
+	"github.com/stripe/stripe-go/transfer"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// streamers earn one cent for every Flake they receive, before the
+	// platform fee is taken.
+	flakeValueCents    = 1
+	platformFeePercent = 20
+	minPayoutCents     = 5000
+	payoutCurrency     = "usd"
+	// tips are held back this long before they can be paid out, so Flakes
+	// bought with a charge that is refunded meanwhile are never paid out.
+	payoutHold = 14 * 24 * time.Hour
+)
+
+var (
+	ErrPayoutsNotEnabled  = errors.New("Finish Stripe onboarding before requesting a payout")
+	ErrPayoutBelowMinimum = errors.New("Balance is below the minimum payout")
+)
+
+type stripeAccount struct {
+	AccountID      string `bun:"stripe_account_id"`
+	PayoutsEnabled bool   `bun:"stripe_payouts_enabled"`
+}
+
+func (db *BUN) getStripeAccount(user_id string) (*stripeAccount, error) {
+	var acc stripeAccount
+
+	err := db.client.NewRaw(
+		"SELECT COALESCE(stripe_account_id, '') AS stripe_account_id, stripe_payouts_enabled FROM users WHERE id = ?",
+		user_id,
+	).Scan(context.Background(), &acc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &acc, nil
+}
+
+// payoutBalance values the Flakes channel_id received that are not part of a
+// payout yet and are past payoutHold. Failed payouts give their Flakes back.
+func payoutBalance(ctx context.Context, idb bun.IDB, channel_id string) (*model.PayoutBalance, error) {
+	var flakes int
+
+	err := idb.NewRaw(
+		"SELECT (SELECT COALESCE(SUM(amount), 0) FROM channel_flakes WHERE channel_id = ? AND created_at <= ?) - (SELECT COALESCE(SUM(flakes), 0) FROM payouts WHERE channel_id = ? AND status <> 'failed')",
+		channel_id, time.Now().Add(-payoutHold), channel_id,
+	).Scan(ctx, &flakes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if flakes < 0 {
+		flakes = 0
+	}
+
+	gross := flakes * flakeValueCents
+	fee := gross * platformFeePercent / 100
+
+	return &model.PayoutBalance{
+		Flakes:       flakes,
+		GrossCents:   gross,
+		FeeCents:     fee,
+		AmountCents:  gross - fee,
+		MinimumCents: minPayoutCents,
+	}, nil
+}
+
+func (db *BUN) GetPayoutBalance(channel_id string) (*model.PayoutBalance, error) {
+	balance, err := payoutBalance(context.Background(), db.client, channel_id)
+
+	if err != nil {
+		fmt.Println("Could not compute payout balance: ", err)
+		return nil, err
+	}
+
+	acc, err := db.getStripeAccount(channel_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	balance.PayoutsEnabled = acc.AccountID != "" && acc.PayoutsEnabled
+
+	return balance, nil
+}
+
+func (db *BUN) GetPayouts(channel_id string) ([]*model.Payout, error) {
+	var payouts []*model.Payout
+
+	err := db.client.NewRaw("SELECT * FROM payouts WHERE channel_id = ? ORDER BY created_at DESC", channel_id).Scan(context.Background(), &payouts)
+
+	if err != nil {
+		fmt.Println("Could not fetch payouts: ", err)
+		return nil, err
+	}
+
+	return payouts, nil
+}
+
+// CreatePayoutOnboardingLink returns a Stripe Connect onboarding link for
+// user_id, creating their connected account the first time.
+func (db *BUN) CreatePayoutOnboardingLink(user_id string) (string, error) {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	acc, err := db.getStripeAccount(user_id)
+
+	if err != nil {
+		return "", err
+	}
+
+	if acc.AccountID == "" {
+		user, err := db.GetUser(user_id)
+
+		if err != nil {
+			return "", err
+		}
+
+		params := &stripe.AccountParams{
+			Type:                  stripe.String(string(stripe.AccountTypeExpress)),
+			Email:                 stripe.String(user.Email),
+			RequestedCapabilities: stripe.StringSlice([]string{"transfers"}),
+		}
+		params.AddMetadata("user_id", user_id)
+
+		a, err := account.New(params)
+
+		if err != nil {
+			fmt.Println("Could not create connected account: ", err)
+			return "", err
+		}
+
+		_, err = db.client.NewRaw("UPDATE users SET stripe_account_id = ?, updated_at = ? WHERE id = ?", a.ID, time.Now(), user_id).Exec(context.Background())
+
+		if err != nil {
+			return "", err
+		}
+
+		acc.AccountID = a.ID
+	}
+
+	client_url := os.Getenv("CLIENT_URL")
+
+	params := &stripe.AccountLinkParams{
+		Account: stripe.String(acc.AccountID),
+		Type:    stripe.String("account_onboarding"),
+	}
+	params.AddExtra("refresh_url", client_url+"/dashboard/payouts?onboarding=refresh")
+	params.AddExtra("return_url", client_url+"/dashboard/payouts?onboarding=return")
+
+	link, err := accountlink.New(params)
+
+	if err != nil {
+		fmt.Println("Could not create onboarding link: ", err)
+		return "", err
+	}
+
+	return link.URL, nil
+}
+
+// SetPayoutsEnabled records whether Stripe lets the connected account receive
+// payouts. It is only called for verified account.updated events, clients
+// can't change the column.
+func (db *BUN) SetPayoutsEnabled(account_id string, enabled bool) error {
+	_, err := db.client.NewRaw(
+		"UPDATE users SET stripe_payouts_enabled = ?, updated_at = ? WHERE stripe_account_id = ?",
+		enabled, time.Now(), account_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not update payouts enabled: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// RequestPayout transfers channel_id's whole payout balance to its connected
+// account. The payout is stored before the transfer is made so a concurrent
+// request cannot pay out the same Flakes twice. When Stripe's answer is
+// unclear the payout is returned as pending.
+func (db *BUN) RequestPayout(channel_id string) (*model.Payout, error) {
+	acc, err := db.getStripeAccount(channel_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.AccountID == "" || !acc.PayoutsEnabled {
+		return nil, ErrPayoutsNotEnabled
+	}
+
+	var payout model.Payout
+	ctx := context.Background()
+
+	err = db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// payouts of one channel are requested one after another.
+		if _, err := tx.NewRaw("SELECT pg_advisory_xact_lock(hashtext(?))", "payouts:"+channel_id).Exec(ctx); err != nil {
+			return err
+		}
+
+		balance, err := payoutBalance(ctx, tx, channel_id)
+
+		if err != nil {
+			return err
+		}
+
+		if balance.AmountCents < minPayoutCents {
+			return ErrPayoutBelowMinimum
+		}
+
+		now := time.Now()
+
+		return tx.NewRaw(
+			"INSERT INTO payouts (id, channel_id, flakes, gross_cents, fee_cents, amount_cents, currency, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, 'pending', ?, ?) RETURNING *",
+			uuid.New().String(), channel_id, balance.Flakes, balance.GrossCents, balance.FeeCents, balance.AmountCents, payoutCurrency, now, now,
+		).Scan(ctx, &payout)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db.transferPayout(&payout, acc.AccountID)
+}
+
+// transferPayout sends payout to account_id. The idempotency key and the
+// transfer group come from the payout, so retrying it never pays twice.
+func (db *BUN) transferPayout(payout *model.Payout, account_id string) (*model.Payout, error) {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	params := &stripe.TransferParams{
+		Amount:        stripe.Int64(int64(payout.AmountCents)),
+		Currency:      stripe.String(payout.Currency),
+		Destination:   stripe.String(account_id),
+		TransferGroup: stripe.String(payout.ID),
+	}
+	params.AddMetadata("payout_id", payout.ID)
+	params.AddMetadata("channel_id", payout.ChannelID)
+	params.SetIdempotencyKey("payout:" + payout.ID)
+
+	t, err := transfer.New(params)
+
+	if err != nil {
+		fmt.Println("Could not transfer payout: ", err)
+
+		// a timeout or a Stripe outage may still have made the transfer, the
+		// payout stays pending until ReconcilePayouts finds out.
+		if !transferRejected(err) {
+			return payout, nil
+		}
+
+		// the Flakes go back to the balance when the payout failed.
+		db.client.NewRaw(
+			"UPDATE payouts SET status = 'failed', failure_reason = ?, updated_at = ? WHERE id = ?",
+			err.Error(), time.Now(), payout.ID,
+		).Exec(context.Background())
+
+		return nil, err
+	}
+
+	return db.markPayoutTransferred(payout.ID, t.ID)
+}
+
+func (db *BUN) markPayoutTransferred(payout_id string, transfer_id string) (*model.Payout, error) {
+	var payout model.Payout
+
+	err := db.client.NewRaw(
+		"UPDATE payouts SET status = 'transferred', stripe_transfer_id = ?, updated_at = ? WHERE id = ? RETURNING *",
+		transfer_id, time.Now(), payout_id,
+	).Scan(context.Background(), &payout)
+
+	if err != nil {
+		fmt.Println("Could not update payout: ", err)
+		return nil, err
+	}
+
+	return &payout, nil
+}
+
+// transferRejected reports whether Stripe definitely refused the transfer.
+// Only then is it safe to give the Flakes back. A conflict means a request
+// with the same idempotency key is still running.
+func transferRejected(err error) bool {
+	var stripeErr *stripe.Error
+
+	if !errors.As(err, &stripeErr) {
+		return false
+	}
+
+	return stripeErr.HTTPStatusCode >= 400 && stripeErr.HTTPStatusCode < 500 && stripeErr.HTTPStatusCode != http.StatusConflict
+}
+
+// ReconcilePayouts settles payouts left pending by a transfer that failed
+// without a clear answer from Stripe. A transfer Stripe already made is
+// recorded, otherwise it is retried with the payout's idempotency key.
+func (db *BUN) ReconcilePayouts() error {
+	var pending []*model.Payout
+
+	// payouts that were just requested are still being transferred.
+	err := db.client.NewRaw(
+		"SELECT * FROM payouts WHERE status = 'pending' AND created_at < ?",
+		time.Now().Add(-time.Minute),
+	).Scan(context.Background(), &pending)
+
+	if err != nil {
+		fmt.Println("Could not fetch pending payouts: ", err)
+		return err
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	for _, payout := range pending {
+		transfers := transfer.List(&stripe.TransferListParams{TransferGroup: stripe.String(payout.ID)})
+
+		if transfers.Next() {
+			db.markPayoutTransferred(payout.ID, transfers.Transfer().ID)
+			continue
+		}
+
+		if err := transfers.Err(); err != nil {
+			fmt.Println("Could not look up payout transfer: ", err)
+			continue
+		}
+
+		acc, err := db.getStripeAccount(payout.ChannelID)
+
+		if err != nil || acc.AccountID == "" {
+			continue
+		}
+
+		db.transferPayout(payout, acc.AccountID)
+	}
+
+	return nil
+}
+
+// SweepPayouts runs ReconcilePayouts every interval until ctx is done.
+func (db *BUN) SweepPayouts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.ReconcilePayouts()
+		}
+	}
+}
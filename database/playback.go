@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	muxgo "github.com/muxinc/mux-go/v5"
+)
+
+var (
+	ErrPlaybackForbidden = errors.New("Not allowed to watch this stream")
+	ErrNoPlaybackID      = errors.New("Nothing to play yet")
+	ErrPlaybackTarget    = errors.New("Pass either video_id or channel_id")
+)
+
+func muxClient() *muxgo.APIClient {
+	return muxgo.NewAPIClient(
+		muxgo.NewConfiguration(muxgo.WithBasicAuth(os.Getenv("MUX_ACCESS"), os.Getenv("MUX_SECRET"))))
+}
+
+func muxPolicy(policy model.PlaybackPolicy) muxgo.PlaybackPolicy {
+	return muxgo.PlaybackPolicy(strings.ToLower(string(policy)))
+}
+
+// SetChannelPlaybackPolicy swaps the channel's live stream playback id for one
+// with policy. The old id is deleted at Mux once the channel points at the new
+// one, so links to it stop working.
+func (db *BUN) SetChannelPlaybackPolicy(user_id string, policy model.PlaybackPolicy) (*model.Channel, error) {
+	channel, err := db.GetChannelInfo(user_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if channel.PlaybackPolicy == policy && channel.PlaybackID != "" {
+		return channel, nil
+	}
+
+	if channel.LivestreamID == "" {
+		return nil, ErrNoPlaybackID
+	}
+
+	client := muxClient()
+
+	created, err := client.LiveStreamsApi.CreateLiveStreamPlaybackId(channel.LivestreamID, muxgo.CreatePlaybackIdRequest{Policy: muxPolicy(policy)})
+
+	if err != nil {
+		fmt.Println("Could not create live stream playback id: ", err)
+		return nil, err
+	}
+
+	_, err = db.client.NewRaw(
+		"UPDATE channels SET playback_id = ?, playback_policy = ?, updated_at = ? WHERE user_id = ?",
+		created.Data.Id, policy, time.Now(), user_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not update channel playback policy: ", err)
+		client.LiveStreamsApi.DeleteLiveStreamPlaybackId(channel.LivestreamID, created.Data.Id)
+		return nil, err
+	}
+
+	old := channel.PlaybackID
+
+	channel.PlaybackID = created.Data.Id
+	channel.PlaybackPolicy = policy
+
+	// the channel already plays the new id, failing to clean up the old one
+	// does not undo the change.
+	if old != "" {
+		if err := client.LiveStreamsApi.DeleteLiveStreamPlaybackId(channel.LivestreamID, old); err != nil {
+			fmt.Println("Could not delete old live stream playback id "+old+": ", err)
+		}
+	}
+
+	return channel, nil
+}
+
+// SetVideoPlaybackPolicy swaps the playback id of the video's Mux asset for
+// one with policy. Videos without an asset have nothing to swap.
+func (db *BUN) SetVideoPlaybackPolicy(id string, policy model.PlaybackPolicy) (*model.Video, error) {
+	var assetID string
+
+	err := db.client.NewRaw("SELECT COALESCE(asset_id, '') FROM videos WHERE id = ?", id).Scan(context.Background(), &assetID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVideoNotFound
+	}
+
+	if err != nil {
+		fmt.Println("Could not fetch video asset: ", err)
+		return nil, err
+	}
+
+	video, err := db.GetVideoByID(id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVideoNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if video.PlaybackPolicy == policy && video.PlaybackID != "" {
+		return video, nil
+	}
+
+	if assetID == "" {
+		return nil, ErrNoPlaybackID
+	}
+
+	client := muxClient()
+
+	created, err := client.AssetsApi.CreateAssetPlaybackId(assetID, muxgo.CreatePlaybackIdRequest{Policy: muxPolicy(policy)})
+
+	if err != nil {
+		fmt.Println("Could not create asset playback id: ", err)
+		return nil, err
+	}
+
+	_, err = db.client.NewRaw(
+		"UPDATE videos SET playback_id = ?, playback_policy = ?, updated_at = ? WHERE id = ?",
+		created.Data.Id, policy, time.Now(), id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not update video playback policy: ", err)
+		client.AssetsApi.DeleteAssetPlaybackId(assetID, created.Data.Id)
+		return nil, err
+	}
+
+	old := video.PlaybackID
+
+	video.PlaybackID = created.Data.Id
+	video.PlaybackPolicy = policy
+
+	if old != "" {
+		if err := client.AssetsApi.DeleteAssetPlaybackId(assetID, old); err != nil {
+			fmt.Println("Could not delete old asset playback id "+old+": ", err)
+		}
+	}
+
+	return video, nil
+}
+
+// CanWatchChannel reports whether viewer_id may play the channel's stream.
+// Signed streams are open to the channel, its moderators and members that are
+// not banned.
+func (db *BUN) CanWatchChannel(viewer_id string, channel *model.Channel) (bool, error) {
+	if channel.PlaybackPolicy != model.PlaybackPolicySigned || viewer_id == channel.UserID {
+		return true, nil
+	}
+
+	if viewer_id == "" {
+		return false, nil
+	}
+
+	if err := db.CheckBan(channel.UserID, viewer_id); err != nil {
+		if errors.Is(err, ErrBanned) || errors.Is(err, ErrTimedOut) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	moderator, err := db.HasRole(viewer_id, model.RoleModerator, channel.UserID)
+
+	if err != nil {
+		return false, err
+	}
+
+	if moderator {
+		return true, nil
+	}
+
+	tier, err := db.membershipTier(viewer_id, channel.UserID)
+
+	if err != nil {
+		return false, err
+	}
+
+	return tier > 0, nil
+}
+
+// PlaybackFor returns the playback id and policy of either video_id or
+// channel_id once viewer_id is allowed to watch it.
+func (db *BUN) PlaybackFor(viewer_id string, video_id string, channel_id string) (string, model.PlaybackPolicy, error) {
+	if (video_id == "") == (channel_id == "") {
+		return "", "", ErrPlaybackTarget
+	}
+
+	if video_id != "" {
+		video, err := db.GetVideoForViewer(viewer_id, video_id)
+
+		if err != nil {
+			return "", "", err
+		}
+
+		if video.IsLocked {
+			return "", "", ErrPlaybackForbidden
+		}
+
+		if video.PlaybackID == "" {
+			return "", "", ErrNoPlaybackID
+		}
+
+		return video.PlaybackID, video.PlaybackPolicy, nil
+	}
+
+	channel, err := db.GetChannelInfo(channel_id)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	allowed, err := db.CanWatchChannel(viewer_id, channel)
+
+	if err != nil {
+		fmt.Println("Could not check channel access: ", err)
+		return "", "", err
+	}
+
+	if !allowed {
+		return "", "", ErrPlaybackForbidden
+	}
+
+	if channel.PlaybackID == "" {
+		return "", "", ErrNoPlaybackID
+	}
+
+	return channel.PlaybackID, channel.PlaybackPolicy, nil
+}
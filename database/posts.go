@@ -10,7 +10,7 @@ import (
 	"github.com/google/uuid"
 )
 
-func (db *BUN) CreatePost(input model.NewPostInput) (bool, error) {
+func (db *BUN) CreatePost(input model.NewPostInput) (*model.Post, error) {
 
 	id := uuid.New().String()
 
@@ -20,21 +20,21 @@ func (db *BUN) CreatePost(input model.NewPostInput) (bool, error) {
 	).Exec(context.Background())
 
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	rows, err := res.RowsAffected()
 
 	if err != nil {
 		fmt.Println("RowsAffected when creating post: ", err)
-		return false, nil
+		return nil, nil
 	}
 
 	if rows > 0 {
-		return true, nil
+		return db.GetPostByID(id)
 	}
 
-	return true, nil
+	return nil, nil
 }
 
 func (db *BUN) GetPostByID(post_id string) (*model.Post, error) {
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// PresenceHeartbeat is how often subscribed viewers refresh their rows in
+	// chat_users and channel_viewers.
+	PresenceHeartbeat = 30 * time.Second
+	// PresenceTTL is how long a row counts as present without a heartbeat. It
+	// spans a few heartbeats so one slow write does not drop a viewer.
+	PresenceTTL = 3 * PresenceHeartbeat
+)
+
+// presenceCutoff is the oldest last_seen_at that still counts as present.
+func presenceCutoff() time.Time {
+	return time.Now().Add(-PresenceTTL)
+}
+
+// TouchChannelViewer marks user_id as watching channel_id right now.
+func (db *BUN) TouchChannelViewer(channel_id string, user_id string) error {
+	now := time.Now()
+
+	_, err := db.client.NewRaw(
+		"INSERT INTO channel_viewers (id, channel_id, user_id, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (channel_id, user_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at",
+		uuid.New().String(), channel_id, user_id, now, now,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not refresh channel viewer: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// refreshPresence moves the last_seen_at of user_id in table forward. It never
+// lists anyone, so a user removed meanwhile, like by a ban, stays removed.
+func (db *BUN) refreshPresence(table string, channel_id string, user_id string) error {
+	_, err := db.client.NewRaw(
+		"UPDATE ? SET last_seen_at = ? WHERE channel_id = ? AND user_id = ?",
+		bun.Ident(table), time.Now(), channel_id, user_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not refresh "+table+": ", err)
+		return err
+	}
+
+	return nil
+}
+
+// joinPresence counts one more connection of user_id in table and reports
+// whether it is the first live one. Connections of a row that expired are not
+// counted anymore.
+func (db *BUN) joinPresence(table string, channel_id string, user_id string) (bool, error) {
+	var connections int
+	now := time.Now()
+
+	err := db.client.NewRaw(
+		"INSERT INTO ? AS p (id, channel_id, user_id, connections, last_seen_at) VALUES (?, ?, ?, 1, ?) ON CONFLICT (channel_id, user_id) DO UPDATE SET connections = CASE WHEN p.last_seen_at < ? THEN 1 ELSE p.connections + 1 END, last_seen_at = EXCLUDED.last_seen_at RETURNING connections",
+		bun.Ident(table), uuid.New().String(), channel_id, user_id, now, presenceCutoff(),
+	).Scan(context.Background(), &connections)
+
+	if err != nil {
+		fmt.Println("Could not join "+table+": ", err)
+		return false, err
+	}
+
+	return connections == 1, nil
+}
+
+// leavePresence counts one connection of user_id in table less and removes the
+// row with the last one, reporting whether it did. A row that already expired
+// was announced by ExpirePresence.
+func (db *BUN) leavePresence(table string, channel_id string, user_id string) (bool, error) {
+	var connections int
+	ctx := context.Background()
+
+	err := db.client.NewRaw(
+		"UPDATE ? SET connections = connections - 1 WHERE channel_id = ? AND user_id = ? RETURNING connections",
+		bun.Ident(table), channel_id, user_id,
+	).Scan(ctx, &connections)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		fmt.Println("Could not leave "+table+": ", err)
+		return false, err
+	}
+
+	if connections > 0 {
+		return false, nil
+	}
+
+	// a connection that joined meanwhile keeps the row.
+	res, err := db.client.NewRaw(
+		"DELETE FROM ? WHERE channel_id = ? AND user_id = ? AND connections <= 0",
+		bun.Ident(table), channel_id, user_id,
+	).Exec(ctx)
+
+	if err != nil {
+		fmt.Println("Could not leave "+table+": ", err)
+		return false, err
+	}
+
+	rows, _ := res.RowsAffected()
+
+	return rows > 0, nil
+}
+
+// JoinChat counts a subscription of user_id to the chat of channel_id and
+// reports whether they just joined.
+func (db *BUN) JoinChat(channel_id string, user_id string) (bool, error) {
+	return db.joinPresence("chat_users", channel_id, user_id)
+}
+
+// RefreshChat is the heartbeat of a chat subscription of user_id.
+func (db *BUN) RefreshChat(channel_id string, user_id string) error {
+	return db.refreshPresence("chat_users", channel_id, user_id)
+}
+
+// LeaveChat ends a subscription of user_id to the chat of channel_id and
+// reports whether it was their last one.
+func (db *BUN) LeaveChat(channel_id string, user_id string) (bool, error) {
+	return db.leavePresence("chat_users", channel_id, user_id)
+}
+
+// JoinChannelViewers counts a viewer connection of user_id to channel_id.
+func (db *BUN) JoinChannelViewers(channel_id string, user_id string) (bool, error) {
+	return db.joinPresence("channel_viewers", channel_id, user_id)
+}
+
+// LeaveChannelViewers ends a viewer connection of user_id to channel_id and
+// reports whether it was their last one.
+func (db *BUN) LeaveChannelViewers(channel_id string, user_id string) (bool, error) {
+	return db.leavePresence("channel_viewers", channel_id, user_id)
+}
+
+// ExpirePresence removes the chat users and channel viewers that stopped
+// sending heartbeats, like the ones left behind by a crashed server. It returns
+// the users that left a chat and the channels whose viewer count changed.
+func (db *BUN) ExpirePresence() ([]*model.UsersInChat, []string, error) {
+	var left []*model.UsersInChat
+	var channels []string
+
+	ctx := context.Background()
+	cutoff := presenceCutoff()
+
+	err := db.client.NewRaw(
+		"DELETE FROM chat_users WHERE last_seen_at < ? RETURNING id, channel_id, user_id",
+		cutoff,
+	).Scan(ctx, &left)
+
+	if err != nil {
+		fmt.Println("Could not expire chat users: ", err)
+		return nil, nil, err
+	}
+
+	err = db.client.NewRaw(
+		"WITH expired AS (DELETE FROM channel_viewers WHERE last_seen_at < ? RETURNING channel_id) SELECT DISTINCT channel_id FROM expired",
+		cutoff,
+	).Scan(ctx, &channels)
+
+	if err != nil {
+		fmt.Println("Could not expire channel viewers: ", err)
+		return left, nil, err
+	}
+
+	return left, channels, nil
+}
@@ -0,0 +1,343 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/utils"
+	"github.com/uptrace/bun"
+)
+
+// a viewer can't pile more than this many different reactions on a message.
+const maxReactionsPerUser = 10
+
+var (
+	ErrInvalidReaction  = errors.New("Reactions must be a single emoji or emote")
+	ErrTooManyReactions = errors.New("You reacted to this message too often")
+)
+
+// GetMessage returns message_id if it was sent in channel_id.
+func (db *BUN) GetMessage(channel_id string, message_id string) (*model.Message, error) {
+	var message model.Message
+
+	err := db.client.NewRaw("SELECT * FROM messages WHERE id = ? AND channel_id = ?", message_id, channel_id).Scan(context.Background(), &message)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+
+	if err != nil {
+		fmt.Println("Could not fetch message: ", err)
+		return nil, err
+	}
+
+	message.Sender, _ = db.GetUser(message.SenderID)
+
+	if err := db.loadMessageDetails([]*model.Message{&message}); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// loadMessageDetails fills in the reply parents, reply counts and reactions of
+// messages with one query each, so a page or a published message is resolved
+// without a query per message.
+func (db *BUN) loadMessageDetails(messages []*model.Message) error {
+	if err := db.loadReplyCounts(messages); err != nil {
+		return err
+	}
+
+	if err := db.loadReactions(messages); err != nil {
+		return err
+	}
+
+	parent_ids := []string{}
+	for _, message := range messages {
+		if message.ReplyParentMessageID != "" {
+			parent_ids = append(parent_ids, message.ReplyParentMessageID)
+		}
+	}
+
+	if len(parent_ids) == 0 {
+		return nil
+	}
+
+	var parents []*model.Message
+
+	// deleted parents are left out, the reply then shows no parent.
+	err := db.client.NewRaw(
+		"SELECT * FROM messages WHERE id IN (?) AND is_deleted = false",
+		bun.In(parent_ids),
+	).Scan(context.Background(), &parents)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not fetch reply parents: ", err)
+		return err
+	}
+
+	if err := db.loadReplyCounts(parents); err != nil {
+		return err
+	}
+
+	if err := db.loadReactions(parents); err != nil {
+		return err
+	}
+
+	byID := map[string]*model.Message{}
+	for _, parent := range parents {
+		parent.Sender, _ = db.GetUser(parent.SenderID)
+		byID[parent.ID] = parent
+	}
+
+	for _, message := range messages {
+		if parent, ok := byID[message.ReplyParentMessageID]; ok && parent.ChannelID == message.ChannelID {
+			message.ReplyParent = parent
+		}
+	}
+
+	return nil
+}
+
+func (db *BUN) loadReplyCounts(messages []*model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var counts []struct {
+		ID    string `bun:"reply_parent_message_id"`
+		Count int    `bun:"count"`
+	}
+
+	err := db.client.NewRaw(
+		"SELECT reply_parent_message_id, COUNT(*) AS count FROM messages WHERE reply_parent_message_id IN (?) AND is_deleted = false GROUP BY reply_parent_message_id",
+		bun.In(messageIDs(messages)),
+	).Scan(context.Background(), &counts)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not count replies: ", err)
+		return err
+	}
+
+	byID := map[string]int{}
+	for _, count := range counts {
+		byID[count.ID] = count.Count
+	}
+
+	for _, message := range messages {
+		message.ReplyCount = byID[message.ID]
+	}
+
+	return nil
+}
+
+func (db *BUN) loadReactions(messages []*model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var rows []struct {
+		MessageID string `bun:"message_id"`
+		Emoji     string `bun:"emoji"`
+		Count     int    `bun:"count"`
+	}
+
+	err := db.client.NewRaw(
+		"SELECT message_id, emoji, COUNT(*) AS count FROM message_reactions WHERE message_id IN (?) GROUP BY message_id, emoji ORDER BY count DESC, MIN(created_at) ASC",
+		bun.In(messageIDs(messages)),
+	).Scan(context.Background(), &rows)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not fetch reactions: ", err)
+		return err
+	}
+
+	byID := map[string][]*model.ReactionCount{}
+	for _, row := range rows {
+		byID[row.MessageID] = append(byID[row.MessageID], &model.ReactionCount{Emoji: row.Emoji, Count: row.Count})
+	}
+
+	for _, message := range messages {
+		message.Reactions = byID[message.ID]
+		if message.Reactions == nil {
+			message.Reactions = []*model.ReactionCount{}
+		}
+	}
+
+	return nil
+}
+
+func messageIDs(messages []*model.Message) []string {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	return ids
+}
+
+// GetReactions counts the reactions on message_id, most used first.
+func (db *BUN) GetReactions(message_id string) ([]*model.ReactionCount, error) {
+	reactions := []*model.ReactionCount{}
+
+	err := db.client.NewRaw(
+		"SELECT emoji, COUNT(*) AS count FROM message_reactions WHERE message_id = ? GROUP BY emoji ORDER BY count DESC, MIN(created_at) ASC",
+		message_id,
+	).Scan(context.Background(), &reactions)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not fetch reactions: ", err)
+		return nil, err
+	}
+
+	return reactions, nil
+}
+
+// reactable returns message_id with its reactions, deleted messages can't be
+// reacted to.
+func (db *BUN) reactable(channel_id string, message_id string) (*model.Message, error) {
+	message, err := db.GetMessage(channel_id, message_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if message.IsDeleted {
+		return nil, ErrMessageNotFound
+	}
+
+	return message, nil
+}
+
+func (db *BUN) AddReaction(channel_id string, message_id string, user_id string, emoji string) (*model.Message, error) {
+	emoji = strings.TrimSpace(emoji)
+
+	if len(emoji) > 64 || len(strings.Fields(emoji)) != 1 || !utils.IsEmoteOnly(emoji) {
+		return nil, ErrInvalidReaction
+	}
+
+	message, err := db.reactable(channel_id, message_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+
+	err = db.client.NewRaw(
+		"SELECT COUNT(*) FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji <> ?",
+		message_id, user_id, emoji,
+	).Scan(context.Background(), &count)
+
+	if err != nil {
+		fmt.Println("Could not count reactions: ", err)
+		return nil, err
+	}
+
+	if count >= maxReactionsPerUser {
+		return nil, ErrTooManyReactions
+	}
+
+	_, err = db.client.NewRaw(
+		"INSERT INTO message_reactions (message_id, user_id, emoji, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		message_id, user_id, emoji, time.Now(),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not add reaction: ", err)
+		return nil, err
+	}
+
+	message.Reactions, err = db.GetReactions(message_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (db *BUN) RemoveReaction(channel_id string, message_id string, user_id string, emoji string) (*model.Message, error) {
+	message, err := db.reactable(channel_id, message_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.client.NewRaw(
+		"DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?",
+		message_id, user_id, strings.TrimSpace(emoji),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not remove reaction: ", err)
+		return nil, err
+	}
+
+	message.Reactions, err = db.GetReactions(message_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// PinMessage pins or unpins message_id in the chat of channel_id.
+func (db *BUN) PinMessage(channel_id string, message_id string, user_id string, pinned bool) (*model.Message, error) {
+	if _, err := db.reactable(channel_id, message_id); err != nil {
+		return nil, err
+	}
+
+	var message model.Message
+	now := time.Now()
+
+	err := db.client.NewRaw(
+		"UPDATE messages SET is_pinned = ?, pinned_by = CASE WHEN ? THEN ? END, pinned_at = CASE WHEN ? THEN ?::timestamp END, updated_at = ? WHERE id = ? AND channel_id = ? RETURNING *",
+		pinned, pinned, user_id, pinned, now, now, message_id, channel_id,
+	).Scan(context.Background(), &message)
+
+	if err != nil {
+		fmt.Println("Could not pin message: ", err)
+		return nil, err
+	}
+
+	message.Sender, _ = db.GetUser(message.SenderID)
+
+	if err := db.loadMessageDetails([]*model.Message{&message}); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// GetPinnedMessages returns the messages pinned in channel_id, latest pin
+// first.
+func (db *BUN) GetPinnedMessages(channel_id string) ([]*model.Message, error) {
+	messages := []*model.Message{}
+
+	err := db.client.NewRaw(
+		"SELECT * FROM messages WHERE channel_id = ? AND is_pinned = true AND is_deleted = false ORDER BY pinned_at DESC",
+		channel_id,
+	).Scan(context.Background(), &messages)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Could not fetch pinned messages: ", err)
+		return nil, err
+	}
+
+	for _, message := range messages {
+		message.Sender, _ = db.GetUser(message.SenderID)
+	}
+
+	if err := db.loadMessageDetails(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRoleScope = errors.New("Global roles cannot be scoped to a channel and channel roles need a channel")
+
+func isChannelRole(role model.Role) bool {
+	return role == model.RoleModerator || role == model.RoleEditor
+}
+
+// HasRole reports whether the user holds role. Admins hold every role and a
+// channel owner holds every channel role on their own channel.
+func (db *BUN) HasRole(user_id string, role model.Role, channel_id string) (bool, error) {
+	if isChannelRole(role) && channel_id != "" && channel_id == user_id {
+		return true, nil
+	}
+
+	if !isChannelRole(role) {
+		channel_id = ""
+	}
+
+	var count int
+
+	err := db.client.NewRaw(
+		"SELECT COUNT(*) FROM user_roles WHERE user_id = ? AND ((role = ? AND channel_id = '') OR (role = ? AND channel_id = ?))",
+		user_id, model.RoleAdmin, role, channel_id,
+	).Scan(context.Background(), &count)
+
+	if err != nil {
+		fmt.Println("Could not check user role: ", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (db *BUN) GrantRole(user_id string, role model.Role, channel_id string, granted_by string) (bool, error) {
+	if isChannelRole(role) == (channel_id == "") {
+		return false, ErrInvalidRoleScope
+	}
+
+	_, err := db.client.NewRaw(
+		"INSERT INTO user_roles (id, user_id, role, channel_id, granted_by, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (user_id, role, channel_id) DO NOTHING",
+		uuid.New().String(), user_id, role, channel_id, granted_by, time.Now(),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not grant role: ", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (db *BUN) RevokeRole(user_id string, role model.Role, channel_id string) (bool, error) {
+	res, err := db.client.NewRaw(
+		"DELETE FROM user_roles WHERE user_id = ? AND role = ? AND channel_id = ?",
+		user_id, role, channel_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not revoke role: ", err)
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	if rows > 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (db *BUN) GetUserRoles(user_id string) ([]*model.UserRole, error) {
+	var roles []*model.UserRole
+
+	err := db.client.NewRaw("SELECT * FROM user_roles WHERE user_id = ? ORDER BY created_at ASC", user_id).Scan(context.Background(), &roles)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (db *BUN) GetChannelRoles(channel_id string) ([]*model.UserRole, error) {
+	var roles []*model.UserRole
+
+	err := db.client.NewRaw("SELECT * FROM user_roles WHERE channel_id = ? ORDER BY created_at ASC", channel_id).Scan(context.Background(), &roles)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
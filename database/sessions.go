@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+	// legacyTokenTTL is the lifetime tokens had before sessions existed. The
+	// deprecated verifyToken keeps it since its clients can't refresh.
+	legacyTokenTTL = 365 * 24 * time.Hour
+)
+
+var ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+
+const sessionColumns = "id, user_id, device, expires_at, last_used_at, created_at"
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// only a hash of the refresh token is stored so a database leak cannot be used
+// to mint access tokens.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (db *BUN) authPayload(session *model.Session, refreshToken string, ttl time.Duration) (*model.AuthPayload, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	accessToken, err := JwtGenerate(context.Background(), session.UserID, session.ID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Current = true
+
+	return &model.AuthPayload{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: expiresAt,
+		RefreshToken:         refreshToken,
+		Session:              session,
+	}, nil
+}
+
+func (db *BUN) CreateSession(user_id string, device string) (*model.AuthPayload, error) {
+	return db.createSession(user_id, device, accessTokenTTL, refreshTokenTTL)
+}
+
+// createLegacySession backs a token of the deprecated verifyToken. Both the
+// token and the session last legacyTokenTTL, so the token stays revocable.
+func (db *BUN) createLegacySession(user_id string) (*model.AuthPayload, error) {
+	return db.createSession(user_id, "", legacyTokenTTL, legacyTokenTTL)
+}
+
+func (db *BUN) createSession(user_id string, device string, accessTTL time.Duration, sessionTTL time.Duration) (*model.AuthPayload, error) {
+	now := time.Now()
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := model.Session{
+		ID:         uuid.New().String(),
+		UserID:     user_id,
+		Device:     device,
+		ExpiresAt:  now.Add(sessionTTL),
+		LastUsedAt: now,
+		CreatedAt:  now,
+	}
+
+	_, err = db.client.NewRaw(
+		"INSERT INTO sessions (id, user_id, device, refresh_token_hash, expires_at, last_used_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.Device, hashRefreshToken(refreshToken), session.ExpiresAt, now, now,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not create session: ", err)
+		return nil, err
+	}
+
+	return db.authPayload(&session, refreshToken, accessTTL)
+}
+
+// RefreshSession rotates the refresh token and issues a new access token. A
+// refresh token that was already rotated away revokes the whole session since
+// it means the token was copied.
+func (db *BUN) RefreshSession(refreshToken string) (*model.AuthPayload, error) {
+	now := time.Now()
+	hash := hashRefreshToken(refreshToken)
+
+	next, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var session model.Session
+
+	err = db.client.NewRaw(
+		"UPDATE sessions SET refresh_token_hash = ?, previous_refresh_token_hash = refresh_token_hash, last_used_at = ?, expires_at = ? WHERE refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ? RETURNING "+sessionColumns,
+		hashRefreshToken(next), now, now.Add(refreshTokenTTL), hash, now,
+	).Scan(context.Background(), &session)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err := db.client.NewRaw(
+			"UPDATE sessions SET revoked_at = ? WHERE previous_refresh_token_hash = ? AND revoked_at IS NULL",
+			now, hash,
+		).Exec(context.Background())
+
+		if err != nil {
+			fmt.Println("Could not revoke session after refresh token reuse: ", err)
+		}
+
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err != nil {
+		fmt.Println("Could not refresh session: ", err)
+		return nil, err
+	}
+
+	return db.authPayload(&session, next, accessTokenTTL)
+}
+
+func (db *BUN) IsSessionActive(id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+
+	var session model.Session
+
+	count, err := db.client.NewSelect().Model(&session).Where("id = ?", id).Where("revoked_at IS NULL").Where("expires_at > ?", time.Now()).Count(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not check session: ", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (db *BUN) ListSessions(user_id string, current_id string) ([]*model.Session, error) {
+	var sessions []*model.Session
+
+	err := db.client.NewRaw(
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_used_at DESC",
+		user_id, time.Now(),
+	).Scan(context.Background(), &sessions)
+
+	if err != nil {
+		fmt.Println("Could not list sessions: ", err)
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == current_id
+	}
+
+	return sessions, nil
+}
+
+func (db *BUN) RevokeSession(user_id string, id string) (bool, error) {
+	res, err := db.client.NewRaw(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), id, user_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not revoke session: ", err)
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	if rows > 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (db *BUN) RevokeAllSessions(user_id string) (bool, error) {
+	_, err := db.client.NewRaw(
+		"UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(), user_id,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not revoke sessions: ", err)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// StripeCheckout is a completed Stripe Checkout session. Kind, UserID,
+// ChannelID, Tier and Flakes come from the metadata the session was created
+// with.
+type StripeCheckout struct {
+	SessionID       string
+	PaymentIntentID string
+	SubscriptionID  string
+	Kind            string
+	UserID          string
+	ChannelID       string
+	Tier            string
+	Flakes          int
+	GiftID          string
+}
+
+const (
+	CheckoutFlakes     = "flakes"
+	CheckoutMembership = "membership"
+)
+
+// StripeRefund is the refund state of a charge. AmountRefunded is the total
+// refunded so far in cents, Refunded is set once all of Amount is.
+type StripeRefund struct {
+	PaymentIntentID string
+	Amount          int64
+	AmountRefunded  int64
+	Refunded        bool
+}
+
+// StripeEventStore applies the effects of a Stripe event. The one handed out
+// by ProcessStripeEvent works inside the event's transaction.
+type StripeEventStore interface {
+	CompleteCheckout(checkout StripeCheckout) error
+	SyncSubscription(subscription StripeSubscription) error
+	RenewSubscription(subscription_id string, expires_at time.Time) error
+	RefundPayment(refund StripeRefund) error
+	SetPayoutsEnabled(account_id string, enabled bool) error
+	FulfillGift(gift_id string) (*MembershipGift, bool, error)
+}
+
+// ProcessStripeEvent claims the event id and runs apply in the same
+// transaction, so the event is recorded exactly when its effects are. It
+// returns false without calling apply when the event was claimed before. A
+// concurrent delivery of the same event waits on the claim and is skipped
+// once the first one commits.
+func (db *BUN) ProcessStripeEvent(id string, kind string, apply func(store StripeEventStore) error) (bool, error) {
+	ctx := context.Background()
+	claimed := false
+
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var claimedID string
+
+		err := tx.NewRaw(
+			"INSERT INTO stripe_events (id, type, processed_at) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING RETURNING id",
+			id, kind, time.Now(),
+		).Scan(ctx, &claimedID)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := apply(&BUN{client: tx}); err != nil {
+			return err
+		}
+
+		claimed = true
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println("Could not process stripe event: ", err)
+		return false, err
+	}
+
+	return claimed, nil
+}
+
+// CompleteCheckout marks the session's payment as paid and hands out what was
+// bought. Flakes are credited with the session as idempotency key, so the same
+// session is never credited twice.
+func (db *BUN) CompleteCheckout(checkout StripeCheckout) error {
+	ctx := context.Background()
+
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		now := time.Now()
+
+		res, err := tx.NewRaw(
+			"UPDATE payments SET status = 'paid', payment_intent_id = ?, kind = ?, flakes = ?, updated_at = ? WHERE session_id = ?",
+			checkout.PaymentIntentID, checkout.Kind, checkout.Flakes, now, checkout.SessionID,
+		).Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			_, err = tx.NewRaw(
+				"INSERT INTO payments (id, user_id, order_id, session_id, payment_intent_id, kind, flakes, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, 'paid', ?, ?)",
+				uuid.New().String(), checkout.UserID, checkout.SessionID, checkout.SessionID, checkout.PaymentIntentID, checkout.Kind, checkout.Flakes, now, now,
+			).Exec(ctx)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		switch checkout.Kind {
+		case CheckoutFlakes:
+			if checkout.Flakes <= 0 {
+				return ErrInvalidFlakes
+			}
+
+			_, err = db.applyFlakes(ctx, tx, checkout.UserID, checkout.Flakes, flakesPurchase, checkout.SessionID, "checkout:"+checkout.SessionID)
+			return err
+		case CheckoutMembership:
+			return db.activateMembership(ctx, tx, checkout)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println("Could not complete checkout: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (db *BUN) activateMembership(ctx context.Context, tx bun.Tx, checkout StripeCheckout) error {
+	if checkout.SubscriptionID == "" || checkout.ChannelID == "" {
+		return fmt.Errorf("membership checkout %s has no subscription or channel", checkout.SessionID)
+	}
+
+	now := time.Now()
+
+	res, err := tx.NewRaw(
+		"UPDATE memberships SET is_active = true, status = ?, updated_at = ? WHERE stripe_subscription_id = ?",
+		MembershipActive, now, checkout.SubscriptionID,
+	).Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows > 0 {
+		return nil
+	}
+
+	_, err = tx.NewRaw(
+		"INSERT INTO memberships (id, channel_id, user_id, gifter, is_gift, is_active, status, tier, stripe_subscription_id, created_at, updated_at) VALUES (?, ?, ?, '', false, true, ?, ?, ?, ?, ?)",
+		uuid.New().String(), checkout.ChannelID, checkout.UserID, MembershipActive, checkout.Tier, checkout.SubscriptionID, now, now,
+	).Exec(ctx)
+
+	return err
+}
+
+// RefundPayment records a refund of the payment behind the charge and takes
+// back what it bought. Flakes are taken back in proportion to the amount
+// refunded, as far as they have not been spent. A gift is revoked once it is
+// refunded in full, partial refunds of gifts are left for support to settle.
+// Memberships bought through a subscription have no payment here, they end
+// when the subscription is cancelled and customer.subscription.deleted
+// arrives.
+func (db *BUN) RefundPayment(refund StripeRefund) error {
+	ctx := context.Background()
+
+	err := db.client.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var payment struct {
+			UserID         string `bun:"user_id"`
+			SessionID      string `bun:"session_id"`
+			Kind           string `bun:"kind"`
+			Flakes         int    `bun:"flakes"`
+			AmountRefunded int64  `bun:"amount_refunded"`
+		}
+
+		err := tx.NewRaw(
+			"SELECT user_id, COALESCE(session_id, '') AS session_id, kind, flakes, amount_refunded FROM payments WHERE payment_intent_id = ? AND status <> 'refunded' FOR UPDATE",
+			refund.PaymentIntentID,
+		).Scan(ctx, &payment)
+
+		// unknown or already refunded payments have nothing left to undo.
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// an earlier refund delivered late is already part of the total.
+		if refund.AmountRefunded <= payment.AmountRefunded && !refund.Refunded {
+			return nil
+		}
+
+		status := "partially_refunded"
+		if refund.Refunded {
+			status = "refunded"
+		}
+
+		_, err = tx.NewRaw(
+			"UPDATE payments SET status = ?, amount_refunded = ?, updated_at = ? WHERE payment_intent_id = ?",
+			status, refund.AmountRefunded, time.Now(), refund.PaymentIntentID,
+		).Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		switch payment.Kind {
+		case CheckoutFlakes:
+			return db.refundFlakes(ctx, tx, refund, payment.UserID, payment.Flakes, payment.AmountRefunded)
+		case CheckoutGift:
+			if !refund.Refunded || payment.SessionID == "" {
+				return nil
+			}
+
+			return db.revokeGift(ctx, tx, payment.SessionID)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println("Could not refund payment: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// refundFlakes takes back the share of flakes that was refunded since
+// previously refunded cents, as far as user_id still has them.
+func (db *BUN) refundFlakes(ctx context.Context, tx bun.Tx, refund StripeRefund, user_id string, flakes int, previously int64) error {
+	if flakes <= 0 || refund.Amount <= 0 {
+		return nil
+	}
+
+	share := func(refunded int64) int {
+		if refunded >= refund.Amount {
+			return flakes
+		}
+		return int(int64(flakes) * refunded / refund.Amount)
+	}
+
+	owed := share(refund.AmountRefunded) - share(previously)
+	if refund.Refunded {
+		owed = flakes - share(previously)
+	}
+
+	if owed <= 0 {
+		return nil
+	}
+
+	balance, err := db.lockFlakes(ctx, tx, user_id)
+
+	if err != nil {
+		return err
+	}
+
+	if balance < owed {
+		owed = balance
+	}
+
+	if owed == 0 {
+		return nil
+	}
+
+	key := "refund:" + refund.PaymentIntentID + ":" + strconv.FormatInt(refund.AmountRefunded, 10)
+
+	_, err = db.applyFlakes(ctx, tx, user_id, -owed, flakesRefund, refund.PaymentIntentID, key)
+	return err
+}
+
+// revokeGift ends the memberships handed out by the gift paid through
+// session_id.
+func (db *BUN) revokeGift(ctx context.Context, tx bun.Tx, session_id string) error {
+	var gift_id string
+
+	err := tx.NewRaw(
+		"UPDATE membership_gifts SET status = 'refunded' WHERE session_id = ? RETURNING id",
+		session_id,
+	).Scan(ctx, &gift_id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewRaw(
+		"UPDATE memberships SET is_active = false, status = ?, updated_at = ? WHERE gift_id = ?",
+		MembershipCancelled, time.Now(), gift_id,
+	).Exec(ctx)
+
+	return err
+}
@@ -0,0 +1,369 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/checkout/session"
+	"github.com/stripe/stripe-go/plan"
+	"github.com/stripe/stripe-go/sub"
+)
+
+const (
+	MembershipActive     = "active"
+	MembershipPastDue    = "past_due"
+	MembershipCancelled  = "cancelled"
+	MembershipIncomplete = "incomplete"
+)
+
+// membershipValid matches the memberships that currently grant their perks. It
+// takes the current time as argument, expires_at holds the server's local time.
+const membershipValid = "is_active = true AND (expires_at IS NULL OR expires_at > ?)"
+
+var (
+	ErrInvalidCost      = errors.New("Cost must be an amount like 4.99")
+	ErrTierNotForSale   = errors.New("This membership tier is not available")
+	ErrAlreadyMember    = errors.New("You already have a membership for this channel")
+	ErrOwnChannel       = errors.New("You cannot become a member of your own channel")
+	ErrNotASubscription = errors.New("This membership is not billed through a subscription")
+)
+
+// StripeSubscription is the billing state of a Stripe subscription. UserID,
+// ChannelID and Tier come from the metadata the subscription was created with.
+type StripeSubscription struct {
+	ID                string
+	Status            string
+	ExpiresAt         time.Time
+	CancelAtPeriodEnd bool
+	UserID            string
+	ChannelID         string
+	Tier              string
+	// EventAt is when Stripe created the event carrying this state.
+	EventAt time.Time
+}
+
+// membershipStatus maps a Stripe subscription status to a membership status.
+func membershipStatus(status string) string {
+	switch stripe.SubscriptionStatus(status) {
+	case stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing:
+		return MembershipActive
+	case stripe.SubscriptionStatusPastDue, stripe.SubscriptionStatusUnpaid:
+		return MembershipPastDue
+	case stripe.SubscriptionStatusIncomplete:
+		return MembershipIncomplete
+	}
+
+	return MembershipCancelled
+}
+
+// parseCents reads a cost like "4.99" as an amount of cents.
+func parseCents(cost string) (int, error) {
+	cost = strings.TrimPrefix(strings.TrimSpace(cost), "$")
+
+	whole, fraction, _ := strings.Cut(cost, ".")
+	if len(fraction) > 2 {
+		return 0, ErrInvalidCost
+	}
+
+	dollars, err := strconv.Atoi(whole)
+	if err != nil || dollars < 0 {
+		return 0, ErrInvalidCost
+	}
+
+	cents := 0
+	if fraction != "" {
+		cents, err = strconv.Atoi(fraction + strings.Repeat("0", 2-len(fraction)))
+		if err != nil {
+			return 0, ErrInvalidCost
+		}
+	}
+
+	total := dollars*100 + cents
+	if total <= 0 {
+		return 0, ErrInvalidCost
+	}
+
+	return total, nil
+}
+
+type membershipPrice struct {
+	ID         string `bun:"id"`
+	Name       string `bun:"name"`
+	PriceCents int    `bun:"price_cents"`
+	Currency   string `bun:"currency"`
+	ProductID  string `bun:"stripe_product_id"`
+	PriceID    string `bun:"stripe_price_id"`
+}
+
+func (db *BUN) getMembershipPrice(channel_id string, tier int) (*membershipPrice, error) {
+	var price membershipPrice
+
+	err := db.client.NewRaw(
+		"SELECT id, name, price_cents, currency, COALESCE(stripe_product_id, '') AS stripe_product_id, COALESCE(stripe_price_id, '') AS stripe_price_id FROM membership_details WHERE channel_id = ? AND tier = ?",
+		channel_id, tier,
+	).Scan(context.Background(), &price)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &price, nil
+}
+
+// syncMembershipPrice gives a tier a monthly Stripe price matching its cost.
+// Stripe prices cannot change, so a new one is created whenever the cost does;
+// existing subscriptions keep the price they signed up with. Prices are made
+// through the Plans API, which Stripe mirrors as a Price with the same id.
+func (db *BUN) syncMembershipPrice(channel_id string, tier int, price_cents int) error {
+	current, err := db.getMembershipPrice(channel_id, tier)
+
+	if err != nil {
+		return err
+	}
+
+	if current.PriceID != "" && current.PriceCents == price_cents {
+		return nil
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	params := &stripe.PlanParams{
+		Amount:   stripe.Int64(int64(price_cents)),
+		Currency: stripe.String(current.Currency),
+		Interval: stripe.String(string(stripe.PlanIntervalMonth)),
+		Nickname: stripe.String(current.Name),
+	}
+	params.AddMetadata("channel_id", channel_id)
+	params.AddMetadata("tier", strconv.Itoa(tier))
+
+	if current.ProductID != "" {
+		params.ProductID = stripe.String(current.ProductID)
+	} else {
+		params.Product = &stripe.PlanProductParams{
+			Name:     stripe.String(current.Name),
+			Metadata: map[string]string{"channel_id": channel_id, "tier": strconv.Itoa(tier)},
+		}
+	}
+
+	p, err := plan.New(params)
+
+	if err != nil {
+		fmt.Println("Could not create membership price: ", err)
+		return err
+	}
+
+	productID := current.ProductID
+	if p.Product != nil {
+		productID = p.Product.ID
+	}
+
+	_, err = db.client.NewRaw(
+		"UPDATE membership_details SET price_cents = ?, stripe_product_id = ?, stripe_price_id = ?, updated_at = ? WHERE id = ?",
+		price_cents, productID, p.ID, time.Now(), current.ID,
+	).Exec(context.Background())
+
+	return err
+}
+
+// CreateMembershipCheckout opens a Stripe Checkout session that subscribes
+// user_id to tier of channel_id. The membership is created by the Stripe
+// webhook once the first invoice is paid.
+func (db *BUN) CreateMembershipCheckout(user_id string, channel_id string, tier int) (string, error) {
+	if user_id == channel_id {
+		return "", ErrOwnChannel
+	}
+
+	price, err := db.getMembershipPrice(channel_id, tier)
+
+	if err != nil || price.PriceID == "" {
+		return "", ErrTierNotForSale
+	}
+
+	memberships, err := db.GetUserMembership(user_id, channel_id)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, membership := range memberships {
+		if !membership.IsGift {
+			return "", ErrAlreadyMember
+		}
+	}
+
+	user, err := db.GetUser(user_id)
+
+	if err != nil {
+		return "", err
+	}
+
+	customerID, err := db.stripeCustomer(user)
+
+	if err != nil {
+		return "", err
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	client_url := os.Getenv("CLIENT_URL")
+	tierID := strconv.Itoa(tier)
+
+	subscriptionData := &stripe.CheckoutSessionSubscriptionDataParams{
+		Items: []*stripe.CheckoutSessionSubscriptionDataItemsParams{
+			{
+				Plan:     stripe.String(price.PriceID),
+				Quantity: stripe.Int64(1),
+			},
+		},
+	}
+	// subscription events carry this metadata, so they can be matched to the
+	// membership even when they arrive before the checkout event.
+	subscriptionData.AddMetadata("user_id", user_id)
+	subscriptionData.AddMetadata("channel_id", channel_id)
+	subscriptionData.AddMetadata("tier", tierID)
+
+	params := &stripe.CheckoutSessionParams{
+		Customer:           stripe.String(customerID),
+		ClientReferenceID:  stripe.String(user_id),
+		Mode:               stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		SubscriptionData:   subscriptionData,
+		SuccessURL:         stripe.String(client_url + "/" + channel_id + "?membership=success"),
+		CancelURL:          stripe.String(client_url + "/" + channel_id + "?membership=cancel"),
+	}
+	params.AddMetadata("kind", CheckoutMembership)
+	params.AddMetadata("user_id", user_id)
+	params.AddMetadata("channel_id", channel_id)
+	params.AddMetadata("tier", tierID)
+
+	s, err := session.New(params)
+
+	if err != nil {
+		fmt.Println("Could not create membership checkout: ", err)
+		return "", err
+	}
+
+	_, err = db.CreatePayment(model.PaymentInput{UserID: user_id, OrderID: s.ID, Status: "pending"})
+
+	if err != nil {
+		return "", err
+	}
+
+	return s.ID, nil
+}
+
+// CancelMembership stops the subscription behind a membership from renewing.
+// The membership stays valid until the period that was paid for ends.
+func (db *BUN) CancelMembership(id string) (*model.Membership, error) {
+	var subscriptionID string
+
+	err := db.client.NewRaw("SELECT COALESCE(stripe_subscription_id, '') FROM memberships WHERE id = ?", id).Scan(context.Background(), &subscriptionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if subscriptionID == "" {
+		return nil, ErrNotASubscription
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	_, err = sub.Update(subscriptionID, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+
+	if err != nil {
+		fmt.Println("Could not cancel subscription: ", err)
+		return nil, err
+	}
+
+	var membership model.Membership
+
+	err = db.client.NewRaw(
+		"UPDATE memberships SET cancel_at_period_end = true, updated_at = ? WHERE id = ? RETURNING *",
+		time.Now(), id,
+	).Scan(context.Background(), &membership)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+// SyncSubscription applies the billing state of a subscription to its
+// membership, creating the membership when the subscription is seen first.
+// Stripe does not deliver events in order, so states older than the last one
+// applied are skipped and a cancelled membership is never activated again.
+func (db *BUN) SyncSubscription(subscription StripeSubscription) error {
+	status := membershipStatus(subscription.Status)
+	isActive := status == MembershipActive || status == MembershipPastDue
+	now := time.Now()
+
+	var expiresAt *time.Time
+	if !subscription.ExpiresAt.IsZero() {
+		expiresAt = &subscription.ExpiresAt
+	}
+
+	var eventAt *time.Time
+	if !subscription.EventAt.IsZero() {
+		eventAt = &subscription.EventAt
+	}
+
+	_, err := db.client.NewRaw(
+		"UPDATE memberships SET status = ?, is_active = ?, expires_at = COALESCE(?, expires_at), cancel_at_period_end = ?, stripe_event_at = COALESCE(?, stripe_event_at), updated_at = ? WHERE stripe_subscription_id = ? AND status <> ? AND (stripe_event_at IS NULL OR ?::timestamp IS NULL OR stripe_event_at <= ?)",
+		status, isActive, expiresAt, subscription.CancelAtPeriodEnd, eventAt, now, subscription.ID, MembershipCancelled, eventAt, eventAt,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not sync subscription: ", err)
+		return err
+	}
+
+	if subscription.UserID == "" || subscription.ChannelID == "" {
+		return nil
+	}
+
+	// a membership that skipped this state already exists and is left alone.
+	_, err = db.client.NewRaw(
+		"INSERT INTO memberships (id, channel_id, user_id, gifter, is_gift, is_active, tier, status, expires_at, cancel_at_period_end, stripe_subscription_id, stripe_event_at, created_at, updated_at) SELECT ?, ?, ?, '', false, ?, ?, ?, ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM memberships WHERE stripe_subscription_id = ?)",
+		uuid.New().String(), subscription.ChannelID, subscription.UserID, isActive, subscription.Tier, status, expiresAt, subscription.CancelAtPeriodEnd, subscription.ID, eventAt, now, now, subscription.ID,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not create subscription membership: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// RenewSubscription extends the memberships paid for by a subscription after
+// an invoice was paid. Cancelled memberships stay cancelled.
+func (db *BUN) RenewSubscription(subscription_id string, expires_at time.Time) error {
+	var expiresAt *time.Time
+	if !expires_at.IsZero() {
+		expiresAt = &expires_at
+	}
+
+	_, err := db.client.NewRaw(
+		"UPDATE memberships SET status = ?, is_active = true, expires_at = COALESCE(?, expires_at), updated_at = ? WHERE stripe_subscription_id = ? AND status <> ?",
+		MembershipActive, expiresAt, time.Now(), subscription_id, MembershipCancelled,
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not renew subscription: ", err)
+		return err
+	}
+
+	return nil
+}
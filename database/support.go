@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+)
+
+func (db *BUN) GetSupportRequests(resolved bool) ([]*model.SupportRequest, error) {
+	var requests []*model.SupportRequest
+
+	err := db.client.NewRaw(
+		"SELECT * FROM support_requests WHERE resolved = ? ORDER BY created_at ASC",
+		resolved,
+	).Scan(context.Background(), &requests)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+func (db *BUN) ResolveSupportRequest(id string, resolved bool) (bool, error) {
+	res, err := db.client.NewRaw(
+		"UPDATE support_requests SET resolved = ?, updated_at = ? WHERE id = ?",
+		resolved, time.Now(), id,
+	).Exec(context.Background())
+
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	if rows > 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (db *BUN) GetWaitlist(can_enter bool, first int) ([]*model.Waitlist, error) {
+	var waitlist []*model.Waitlist
+
+	err := db.client.NewRaw(
+		"SELECT * FROM waitlists WHERE can_enter = ? ORDER BY created_at ASC LIMIT ?",
+		can_enter, first,
+	).Scan(context.Background(), &waitlist)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return waitlist, nil
+}
+
+func (db *BUN) SetWaitlistAccess(id string, can_enter bool) (bool, error) {
+	res, err := db.client.NewRaw(
+		"UPDATE waitlists SET can_enter = ? WHERE id = ?",
+		can_enter, id,
+	).Exec(context.Background())
+
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	if rows > 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
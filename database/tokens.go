@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	loginTokenTTL = 10 * time.Minute
+
+	// failed verifications allowed inside lockoutWindow before further attempts
+	// are refused.
+	maxUserLoginAttempts = 5
+	maxIPLoginAttempts   = 20
+	lockoutWindow        = 15 * time.Minute
+)
+
+var ErrLoginLocked = errors.New("Too many login attempts, try again later")
+
+// loginLocked reports whether the user or the address has used up its failed
+// attempts for the current window.
+func (db *BUN) loginLocked(user_id string, ip string) (bool, error) {
+	since := time.Now().Add(-lockoutWindow)
+
+	var userAttempts int
+	err := db.client.NewRaw(
+		"SELECT COUNT(*) FROM login_attempts WHERE user_id = ? AND created_at > ?",
+		user_id, since,
+	).Scan(context.Background(), &userAttempts)
+
+	if err != nil {
+		return false, err
+	}
+
+	if userAttempts >= maxUserLoginAttempts {
+		return true, nil
+	}
+
+	if ip == "" {
+		return false, nil
+	}
+
+	var ipAttempts int
+	err = db.client.NewRaw(
+		"SELECT COUNT(*) FROM login_attempts WHERE ip_address = ? AND created_at > ?",
+		ip, since,
+	).Scan(context.Background(), &ipAttempts)
+
+	if err != nil {
+		return false, err
+	}
+
+	return ipAttempts >= maxIPLoginAttempts, nil
+}
+
+// recordFailedLogin stores a failed verification. Once the user runs out of
+// attempts any outstanding code is burned so it cannot be guessed from another
+// address later.
+func (db *BUN) recordFailedLogin(user_id string, ip string) {
+	_, err := db.client.NewRaw(
+		"INSERT INTO login_attempts (id, user_id, ip_address, created_at) VALUES (?, ?, ?, ?)",
+		uuid.New().String(), user_id, ip, time.Now(),
+	).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not record failed login attempt: ", err)
+		return
+	}
+
+	locked, err := db.loginLocked(user_id, "")
+
+	if err == nil && locked {
+		db.deleteLoginTokens(user_id)
+	}
+}
+
+func (db *BUN) deleteLoginTokens(user_id string) {
+	_, err := db.client.NewRaw("DELETE FROM tokens WHERE user_id = ?", user_id).Exec(context.Background())
+
+	if err != nil {
+		fmt.Println("Could not delete login tokens: ", err)
+	}
+}
+
+// consumeLoginToken deletes the matching unexpired code and reports whether one
+// existed, so a code can only ever be exchanged once.
+func (db *BUN) consumeLoginToken(user_id string, token string) (bool, error) {
+	res, err := db.client.NewRaw(
+		"DELETE FROM tokens WHERE user_id = ? AND token = ? AND expires_at > ?",
+		user_id, token, time.Now(),
+	).Exec(context.Background())
+
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (db *BUN) PurgeStaleTokens() (int64, error) {
+	now := time.Now()
+
+	res, err := db.client.NewRaw("DELETE FROM tokens WHERE expires_at <= ?", now).Exec(context.Background())
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.client.NewRaw("DELETE FROM login_attempts WHERE created_at <= ?", now.Add(-lockoutWindow)).Exec(context.Background())
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// SweepTokens purges expired login codes and old attempts every interval until
+// ctx is done.
+func (db *BUN) SweepTokens(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := db.PurgeStaleTokens()
+			if err != nil {
+				fmt.Println("Could not purge stale tokens: ", err)
+				continue
+			}
+
+			if purged > 0 {
+				fmt.Println("Purged stale login tokens: ", purged)
+			}
+		}
+	}
+}
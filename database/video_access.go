@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/uptrace/bun"
+)
+
+// videoVisible hides invisible videos from everyone but their channel. It
+// takes the viewer's id as argument.
+const videoVisible = "(is_visible = true OR channel_id = ?)"
+
+var ErrVideoNotFound = errors.New("Video not found")
+
+// membershipTier returns the highest tier user_id holds a valid membership for
+// on channel_id, or 0 without one.
+func (db *BUN) membershipTier(user_id string, channel_id string) (int, error) {
+	var tier int
+
+	err := db.client.NewRaw(
+		"SELECT COALESCE(MAX(tier::int), 0) FROM memberships WHERE user_id = ? AND channel_id = ? AND tier ~ '^[0-9]+$' AND "+membershipValid,
+		user_id, channel_id, time.Now(),
+	).Scan(context.Background(), &tier)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return tier, nil
+}
+
+// membershipTiers returns the highest tier user_id holds a valid membership
+// for on each of channel_ids. Channels without one are left out.
+func (db *BUN) membershipTiers(user_id string, channel_ids []string) (map[string]int, error) {
+	tiers := map[string]int{}
+
+	if len(channel_ids) == 0 {
+		return tiers, nil
+	}
+
+	var rows []struct {
+		ChannelID string `bun:"channel_id"`
+		Tier      int    `bun:"tier"`
+	}
+
+	err := db.client.NewRaw(
+		"SELECT channel_id, MAX(tier::int) AS tier FROM memberships WHERE user_id = ? AND channel_id IN (?) AND tier ~ '^[0-9]+$' AND "+membershipValid+" GROUP BY channel_id",
+		user_id, bun.In(channel_ids), time.Now(),
+	).Scan(context.Background(), &rows)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		tiers[row.ChannelID] = row.Tier
+	}
+
+	return tiers, nil
+}
+
+// CanWatchVideo reports whether viewer_id may play video. Premium videos need
+// an active membership of at least the video's tier, the channel can always
+// watch its own videos.
+func (db *BUN) CanWatchVideo(viewer_id string, video *model.Video) (bool, error) {
+	if !needsMembership(viewer_id, video) {
+		return true, nil
+	}
+
+	if viewer_id == "" {
+		return false, nil
+	}
+
+	tier, err := db.membershipTier(viewer_id, video.ChannelID)
+
+	if err != nil {
+		return false, err
+	}
+
+	return tierAllows(tier, video), nil
+}
+
+// needsMembership reports whether viewer_id needs a membership to play video.
+func needsMembership(viewer_id string, video *model.Video) bool {
+	return video.IsPremium && viewer_id != video.ChannelID
+}
+
+func tierAllows(tier int, video *model.Video) bool {
+	required := video.Tier
+	if required < 1 {
+		required = 1
+	}
+
+	return tier >= required
+}
+
+// applyVideoAccess removes the media of every video viewer_id may not watch,
+// so the rest of the video can still be listed. The viewer's tiers for all
+// channels involved are loaded at once.
+func (db *BUN) applyVideoAccess(viewer_id string, videos ...*model.Video) error {
+	var channel_ids []string
+	seen := map[string]bool{}
+
+	for _, video := range videos {
+		if needsMembership(viewer_id, video) && !seen[video.ChannelID] {
+			seen[video.ChannelID] = true
+			channel_ids = append(channel_ids, video.ChannelID)
+		}
+	}
+
+	tiers := map[string]int{}
+
+	if viewer_id != "" {
+		var err error
+
+		tiers, err = db.membershipTiers(viewer_id, channel_ids)
+
+		if err != nil {
+			fmt.Println("Could not check video access: ", err)
+			return err
+		}
+	}
+
+	for _, video := range videos {
+		if !needsMembership(viewer_id, video) || tierAllows(tiers[video.ChannelID], video) {
+			continue
+		}
+
+		video.Media = ""
+		video.PlaybackID = ""
+		video.IsLocked = true
+	}
+
+	return nil
+}
+
+// GetVideoForViewer returns video id as viewer_id may see it.
+func (db *BUN) GetVideoForViewer(viewer_id string, id string) (*model.Video, error) {
+	var video model.Video
+
+	err := db.client.NewRaw("SELECT * FROM videos WHERE id = ? AND "+videoVisible, id, viewer_id).Scan(context.Background(), &video)
+
+	if err != nil {
+		return nil, ErrVideoNotFound
+	}
+
+	if err := db.applyVideoAccess(viewer_id, &video); err != nil {
+		return nil, err
+	}
+
+	return &video, nil
+}
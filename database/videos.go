@@ -58,16 +58,7 @@ func (db *BUN) GetVideoJob(job_id string) (string, error) {
 }
 
 func (db *BUN) CreateChannelViewer(channelID string, userID string) (int, error) {
-
-	var now = time.Now()
-	id := uuid.New().String()
-
-	_, err := db.client.NewRaw(
-		"INSERT INTO ? (id, channel_id, user_id, created_at) VALUES (?, ?, ?, ?)",
-		bun.Ident("channel_viewers"), id, channelID, userID, now,
-	).Exec(context.Background())
-
-	if err != nil {
+	if err := db.TouchChannelViewer(channelID, userID); err != nil {
 		fmt.Println("Error found when inserting Channel view: ", err)
 		return 0, err
 	}
@@ -80,7 +71,7 @@ func (db *BUN) CreateChannelViewer(channelID string, userID string) (int, error)
 func (db *BUN) DeleteChannelView(channel_id string, user_id string) (int, error) {
 	var channel_view model.ChannelViewer
 
-	row, err := db.client.NewDelete().Model(&channel_view).Where("channel_id = ? AND user_id = ?", channel_id, user_id).Returning("*").Exec(context.Background())
+	row, err := db.client.NewDelete().Model(&channel_view).Where("channel_id = ? AND user_id = ?", channel_id, user_id).Exec(context.Background())
 	count, _ := db.GetChannelViewers(channel_id)
 
 	if err != nil {
@@ -103,7 +94,7 @@ func (db *BUN) DeleteChannelView(channel_id string, user_id string) (int, error)
 
 func (db *BUN) GetChannelViewers(channel_id string) (int, error) {
 	var channel_viewer model.ChannelViewer
-	count, err := db.client.NewSelect().Model(&channel_viewer).Where("channel_id = ?", channel_id).Count(context.Background())
+	count, err := db.client.NewSelect().Model(&channel_viewer).Where("channel_id = ? AND last_seen_at >= ?", channel_id, presenceCutoff()).Count(context.Background())
 	if err != nil {
 		fmt.Println("Could not get channel views: ", err)
 		return 0, err
@@ -246,7 +237,7 @@ func (db *BUN) DeleteVideo(id string) (bool, error) {
 	return false, nil
 }
 
-func (db *BUN) GetVideos(channelID string, first int, after string) (*model.VideosResult, error) {
+func (db *BUN) GetVideos(viewer_id string, channelID string, first int, after string) (*model.VideosResult, error) {
 	var videos []*model.Video
 	var decodedCursor string
 	b, err := base64.StdEncoding.DecodeString(after)
@@ -261,8 +252,8 @@ func (db *BUN) GetVideos(channelID string, first int, after string) (*model.Vide
 
 	if after == "" {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE channel_id = ? ORDER BY created_at ASC LIMIT ?",
-			channelID, first,
+			"SELECT * FROM videos WHERE channel_id = ? AND "+videoVisible+" ORDER BY created_at ASC LIMIT ?",
+			channelID, viewer_id, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -270,8 +261,8 @@ func (db *BUN) GetVideos(channelID string, first int, after string) (*model.Vide
 		}
 	} else {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE channel_id = ? AND created_at > ? ORDER BY created_at ASC LIMIT ?",
-			channelID, t, first,
+			"SELECT * FROM videos WHERE channel_id = ? AND "+videoVisible+" AND created_at > ? ORDER BY created_at ASC LIMIT ?",
+			channelID, viewer_id, t, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -296,6 +287,10 @@ func (db *BUN) GetVideos(channelID string, first int, after string) (*model.Vide
 		return result, nil
 	}
 
+	if err := db.applyVideoAccess(viewer_id, videos...); err != nil {
+		return nil, err
+	}
+
 	for _, v := range videos {
 		v.Views, _ = db.GetVideoViews(v.ID)
 		edges = append(edges, &model.VideosEdge{
@@ -307,7 +302,7 @@ func (db *BUN) GetVideos(channelID string, first int, after string) (*model.Vide
 	var endCursor = base64.StdEncoding.EncodeToString([]byte(videos[len(videos)-1].CreatedAt.String()))
 	var hasNextPage bool
 
-	count, err := db.client.NewSelect().Model(&videos).Where("channel_id = ?", channelID).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
+	count, err := db.client.NewSelect().Model(&videos).Where("channel_id = ?", channelID).Where(videoVisible, viewer_id).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not count remaining video rows for pagination: ", err)
@@ -331,7 +326,7 @@ func (db *BUN) GetVideos(channelID string, first int, after string) (*model.Vide
 	return result, nil
 }
 
-func (db *BUN) GetAllVideos(first int, after string) (*model.VideosResult, error) {
+func (db *BUN) GetAllVideos(viewer_id string, first int, after string) (*model.VideosResult, error) {
 	var videos []*model.Video
 	var decodedCursor string
 	b, err := base64.StdEncoding.DecodeString(after)
@@ -346,8 +341,8 @@ func (db *BUN) GetAllVideos(first int, after string) (*model.VideosResult, error
 
 	if after == "" {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos ORDER BY created_at ASC LIMIT ?",
-			first,
+			"SELECT * FROM videos WHERE "+videoVisible+" ORDER BY created_at ASC LIMIT ?",
+			viewer_id, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -355,8 +350,8 @@ func (db *BUN) GetAllVideos(first int, after string) (*model.VideosResult, error
 		}
 	} else {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE created_at > ? ORDER BY created_at ASC LIMIT ?",
-			t, first,
+			"SELECT * FROM videos WHERE "+videoVisible+" AND created_at > ? ORDER BY created_at ASC LIMIT ?",
+			viewer_id, t, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -381,6 +376,10 @@ func (db *BUN) GetAllVideos(first int, after string) (*model.VideosResult, error
 		return result, nil
 	}
 
+	if err := db.applyVideoAccess(viewer_id, videos...); err != nil {
+		return nil, err
+	}
+
 	for _, v := range videos {
 		v.Views, _ = db.GetVideoViews(v.ID)
 		edges = append(edges, &model.VideosEdge{
@@ -392,7 +391,7 @@ func (db *BUN) GetAllVideos(first int, after string) (*model.VideosResult, error
 	var endCursor = base64.StdEncoding.EncodeToString([]byte(videos[len(videos)-1].CreatedAt.String()))
 	var hasNextPage bool
 
-	count, err := db.client.NewSelect().Model(&videos).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
+	count, err := db.client.NewSelect().Model(&videos).Where(videoVisible, viewer_id).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not count remaining video rows for pagination: ", err)
@@ -416,7 +415,7 @@ func (db *BUN) GetAllVideos(first int, after string) (*model.VideosResult, error
 	return result, nil
 }
 
-func (db *BUN) GetVideosByCategory(category string, first int, after string) (*model.VideosResult, error) {
+func (db *BUN) GetVideosByCategory(viewer_id string, category string, first int, after string) (*model.VideosResult, error) {
 	var videos []*model.Video
 	var decodedCursor string
 	b, err := base64.StdEncoding.DecodeString(after)
@@ -431,8 +430,8 @@ func (db *BUN) GetVideosByCategory(category string, first int, after string) (*m
 
 	if after == "" {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE category = ? ORDER BY created_at ASC LIMIT ?",
-			category, first,
+			"SELECT * FROM videos WHERE category = ? AND "+videoVisible+" ORDER BY created_at ASC LIMIT ?",
+			category, viewer_id, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -440,8 +439,8 @@ func (db *BUN) GetVideosByCategory(category string, first int, after string) (*m
 		}
 	} else {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE channel_id = ? AND created_at > ? ORDER BY created_at ASC LIMIT ?",
-			category, t, first,
+			"SELECT * FROM videos WHERE category = ? AND "+videoVisible+" AND created_at > ? ORDER BY created_at ASC LIMIT ?",
+			category, viewer_id, t, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -466,6 +465,10 @@ func (db *BUN) GetVideosByCategory(category string, first int, after string) (*m
 		return result, nil
 	}
 
+	if err := db.applyVideoAccess(viewer_id, videos...); err != nil {
+		return nil, err
+	}
+
 	for _, v := range videos {
 		v.Views, _ = db.GetVideoViews(v.ID)
 		edges = append(edges, &model.VideosEdge{
@@ -477,7 +480,7 @@ func (db *BUN) GetVideosByCategory(category string, first int, after string) (*m
 	var endCursor = base64.StdEncoding.EncodeToString([]byte(videos[len(videos)-1].CreatedAt.String()))
 	var hasNextPage bool
 
-	count, err := db.client.NewSelect().Model(&videos).Where("category = ?", category).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
+	count, err := db.client.NewSelect().Model(&videos).Where("category = ?", category).Where(videoVisible, viewer_id).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not count remaining video rows for pagination: ", err)
@@ -514,7 +517,7 @@ func (db *BUN) GetVideoByID(id string) (*model.Video, error) {
 	return &video, nil
 }
 
-func (db *BUN) SearchVideos(query string, first int, after string) (*model.VideosResult, error) {
+func (db *BUN) SearchVideos(viewer_id string, query string, first int, after string) (*model.VideosResult, error) {
 	var videos []*model.Video
 	var decodedCursor string
 	b, err := base64.StdEncoding.DecodeString(after)
@@ -529,8 +532,8 @@ func (db *BUN) SearchVideos(query string, first int, after string) (*model.Video
 
 	if after == "" {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE LOWER(title) LIKE LOWER(?) OR LOWER(caption) LIKE LOWER(?) ORDER BY created_at ASC LIMIT ?",
-			"%"+query+"%", "%"+query+"%", first,
+			"SELECT * FROM videos WHERE (LOWER(title) LIKE LOWER(?) OR LOWER(caption) LIKE LOWER(?)) AND "+videoVisible+" ORDER BY created_at ASC LIMIT ?",
+			"%"+query+"%", "%"+query+"%", viewer_id, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch videos: ", err)
@@ -538,8 +541,8 @@ func (db *BUN) SearchVideos(query string, first int, after string) (*model.Video
 		}
 	} else {
 		err := db.client.NewRaw(
-			"SELECT * FROM videos WHERE LOWER(title) LIKE LOWER(?) OR LOWER(caption) LIKE LOWER(?) AND created_at > ? ORDER BY created_at ASC LIMIT ?",
-			"%"+query+"%", "%"+query+"%", t, first,
+			"SELECT * FROM videos WHERE (LOWER(title) LIKE LOWER(?) OR LOWER(caption) LIKE LOWER(?)) AND "+videoVisible+" AND created_at > ? ORDER BY created_at ASC LIMIT ?",
+			"%"+query+"%", "%"+query+"%", viewer_id, t, first,
 		).Scan(context.Background(), &videos)
 		if err != nil {
 			fmt.Println("Could not fetch sesrched videos: ", err)
@@ -564,6 +567,10 @@ func (db *BUN) SearchVideos(query string, first int, after string) (*model.Video
 		return result, nil
 	}
 
+	if err := db.applyVideoAccess(viewer_id, videos...); err != nil {
+		return nil, err
+	}
+
 	for _, v := range videos {
 		v.Views, _ = db.GetVideoViews(v.ID)
 		edges = append(edges, &model.VideosEdge{
@@ -575,7 +582,7 @@ func (db *BUN) SearchVideos(query string, first int, after string) (*model.Video
 	var endCursor = base64.StdEncoding.EncodeToString([]byte(videos[len(videos)-1].CreatedAt.String()))
 	var hasNextPage bool
 
-	count, err := db.client.NewSelect().Model(&videos).Where("LOWER(title) LIKE LOWER(?) OR LOWER(caption) LIKE LOWER(?)", query, query).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
+	count, err := db.client.NewSelect().Model(&videos).Where("(LOWER(title) LIKE LOWER(?) OR LOWER(caption) LIKE LOWER(?))", "%"+query+"%", "%"+query+"%").Where(videoVisible, viewer_id).Where("created_at > ?", videos[len(videos)-1].CreatedAt).Count(context.Background())
 
 	if err != nil {
 		fmt.Println("Could not count remaining video rows for pagination: ", err)
@@ -8,12 +8,19 @@ import (
 	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
+func accessDenied() *gqlerror.Error {
+	return &gqlerror.Error{
+		Message: "Access Denied",
+		Extensions: map[string]interface{}{
+			"code": "UNAUTHENTICATED",
+		},
+	}
+}
+
 func Auth(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
 	tokenData := middlewares.CtxValue(ctx)
 	if tokenData == nil {
-		return nil, &gqlerror.Error{
-			Message: "Access Denied",
-		}
+		return nil, accessDenied()
 	}
 
 	return next(ctx)
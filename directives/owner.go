@@ -0,0 +1,120 @@
+package directives
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/middlewares"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func Forbidden() *gqlerror.Error {
+	return &gqlerror.Error{
+		Message: "Forbidden",
+		Extensions: map[string]interface{}{
+			"code": "FORBIDDEN",
+		},
+	}
+}
+
+// Owner only lets the request through when the caller owns the resource named
+// by arg. arg may name several arguments separated by "|", owning any of them
+// is enough. With role, holding it for the owner's channel is enough too.
+func Owner(ctx context.Context, obj interface{}, next graphql.Resolver, arg string, entity *model.OwnedEntity, role *model.Role) (interface{}, error) {
+	tokenData := middlewares.CtxValue(ctx)
+	if tokenData == nil {
+		return nil, accessDenied()
+	}
+
+	kind := model.OwnedEntityUser
+	if entity != nil {
+		kind = *entity
+	}
+
+	for _, path := range strings.Split(arg, "|") {
+		value, ok := argumentValue(ctx, path)
+		if !ok {
+			continue
+		}
+
+		owner, err := ownerOf(kind, value)
+		if err != nil {
+			continue
+		}
+
+		if owner == tokenData.ID {
+			return next(ctx)
+		}
+
+		// channels are owned by the user of the same id.
+		if role != nil {
+			if ok, _ := database.DB.HasRole(tokenData.ID, *role, owner); ok {
+				return next(ctx)
+			}
+		}
+	}
+
+	return nil, Forbidden()
+}
+
+// argumentValue resolves a dotted path such as "input.sender_id" against the
+// raw arguments of the current field.
+func argumentValue(ctx context.Context, path string) (string, bool) {
+	fc := graphql.GetFieldContext(ctx)
+	oc := graphql.GetOperationContext(ctx)
+	if fc == nil || oc == nil {
+		return "", false
+	}
+
+	var current interface{} = fc.Field.ArgumentMap(oc.Variables)
+
+	for _, key := range strings.Split(path, ".") {
+		values, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		current, ok = values[key]
+		if !ok {
+			return "", false
+		}
+	}
+
+	value, ok := current.(string)
+	if !ok || value == "" {
+		return "", false
+	}
+
+	return value, true
+}
+
+func ownerOf(entity model.OwnedEntity, id string) (string, error) {
+	switch entity {
+	case model.OwnedEntityUser:
+		return id, nil
+	case model.OwnedEntityPost:
+		post, err := database.DB.GetPostByID(id)
+		if err != nil {
+			return "", err
+		}
+		return post.Author, nil
+	case model.OwnedEntityVideo:
+		video, err := database.DB.GetVideoByID(id)
+		if err != nil {
+			return "", err
+		}
+		return video.ChannelID, nil
+	case model.OwnedEntityMembership:
+		membership, err := database.DB.GetMembershipById(id)
+		if err != nil {
+			return "", err
+		}
+		return membership.UserID, nil
+	}
+
+	return "", fmt.Errorf("unknown owned entity: %s", entity)
+}
@@ -0,0 +1,33 @@
+package directives
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/middlewares"
+)
+
+func HasRole(ctx context.Context, obj interface{}, next graphql.Resolver, role model.Role, channelArg *string) (interface{}, error) {
+	tokenData := middlewares.CtxValue(ctx)
+	if tokenData == nil {
+		return nil, accessDenied()
+	}
+
+	channelID := ""
+	if channelArg != nil {
+		value, ok := argumentValue(ctx, *channelArg)
+		if !ok {
+			return nil, Forbidden()
+		}
+		channelID = value
+	}
+
+	allowed, err := database.DB.HasRole(tokenData.ID, role, channelID)
+	if err != nil || !allowed {
+		return nil, Forbidden()
+	}
+
+	return next(ctx)
+}
@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/pubsub"
+	"github.com/google/uuid"
+)
+
+// chatEvent is how chat events travel through the broker. Interfaces can't be
+// decoded from JSON, so exactly one of the fields is set instead.
+type chatEvent struct {
+	MessageCreated          *model.MessageCreated          `json:"message_created,omitempty"`
+	MessageDeleted          *model.MessageDeleted          `json:"message_deleted,omitempty"`
+	MessageReactionsChanged *model.MessageReactionsChanged `json:"message_reactions_changed,omitempty"`
+	MessagePinned           *model.MessagePinned           `json:"message_pinned,omitempty"`
+	UserJoined              *model.UserJoined              `json:"user_joined,omitempty"`
+	UserLeft                *model.UserLeft                `json:"user_left,omitempty"`
+	TipReceived             *model.TipReceived             `json:"tip_received,omitempty"`
+	ChatSettingsChanged     *model.ChatSettingsChanged     `json:"chat_settings_changed,omitempty"`
+}
+
+func (e chatEvent) event() model.ChatEvent {
+	switch {
+	case e.MessageCreated != nil:
+		return e.MessageCreated
+	case e.MessageDeleted != nil:
+		return e.MessageDeleted
+	case e.MessageReactionsChanged != nil:
+		return e.MessageReactionsChanged
+	case e.MessagePinned != nil:
+		return e.MessagePinned
+	case e.UserJoined != nil:
+		return e.UserJoined
+	case e.UserLeft != nil:
+		return e.UserLeft
+	case e.TipReceived != nil:
+		return e.TipReceived
+	case e.ChatSettingsChanged != nil:
+		return e.ChatSettingsChanged
+	}
+
+	return nil
+}
+
+// message is what getMessages pushed for the event before chat events
+// existed, nil for events it never carried.
+func (e chatEvent) message() *model.Message {
+	switch {
+	case e.MessageCreated != nil:
+		return e.MessageCreated.Message
+	case e.MessageDeleted != nil:
+		e.MessageDeleted.Message.Event = model.MessageEventDeleted
+		return e.MessageDeleted.Message
+	case e.MessageReactionsChanged != nil:
+		e.MessageReactionsChanged.Message.Event = model.MessageEventReactionsChanged
+		e.MessageReactionsChanged.Message.Reactions = e.MessageReactionsChanged.Reactions
+		return e.MessageReactionsChanged.Message
+	case e.MessagePinned != nil:
+		e.MessagePinned.Message.Event = model.MessageEventUnpinned
+		if e.MessagePinned.Pinned {
+			e.MessagePinned.Message.Event = model.MessageEventPinned
+		}
+		return e.MessagePinned.Message
+	case e.TipReceived != nil:
+		return e.TipReceived.Message
+	case e.ChatSettingsChanged != nil:
+		return settingsMessage(e.ChatSettingsChanged)
+	}
+
+	return nil
+}
+
+// settingsMessage is the "settings" system message getMessages showed for a
+// change of chat modes. Its id is derived from the event so every subscriber
+// sees the same message.
+func settingsMessage(event *model.ChatSettingsChanged) *model.Message {
+	sender, _ := database.DB.GetUser(event.ChannelID)
+
+	return &model.Message{
+		ID:          uuid.NewSHA1(uuid.NameSpaceOID, []byte(event.ChannelID+event.CreatedAt.String())).String(),
+		ChannelID:   event.ChannelID,
+		SenderID:    event.ChannelID,
+		Sender:      sender,
+		Message:     event.Summary,
+		MessageType: "settings",
+		Amount:      event.Settings.SlowModeSeconds,
+		CreatedAt:   event.CreatedAt,
+		UpdatedAt:   event.CreatedAt,
+	}
+}
+
+// publishChat sends event to everyone subscribed to the chat of channelID.
+func (r *Resolver) publishChat(channelID string, event model.ChatEvent) {
+	var envelope chatEvent
+
+	switch event := event.(type) {
+	case *model.MessageCreated:
+		envelope.MessageCreated = event
+	case *model.MessageDeleted:
+		envelope.MessageDeleted = event
+	case *model.MessageReactionsChanged:
+		envelope.MessageReactionsChanged = event
+	case *model.MessagePinned:
+		envelope.MessagePinned = event
+	case *model.UserJoined:
+		envelope.UserJoined = event
+	case *model.UserLeft:
+		envelope.UserLeft = event
+	case *model.TipReceived:
+		envelope.TipReceived = event
+	case *model.ChatSettingsChanged:
+		envelope.ChatSettingsChanged = event
+	default:
+		return
+	}
+
+	r.publish(chatTopic(channelID), envelope)
+}
+
+// joinChat lists userID in the chat of channelID until ctx is done, sending
+// heartbeats meanwhile so the listing expires if this server dies. Several
+// subscriptions of one user share the listing, it ends with the last of them.
+// Banned users can still read the chat but are not listed in it.
+func (r *Resolver) joinChat(ctx context.Context, channelID string, userID string) {
+	if userID == "" || database.DB.CheckBan(channelID, userID) != nil {
+		return
+	}
+
+	user, err := database.DB.GetUser(userID)
+	if err != nil {
+		return
+	}
+
+	joined, err := database.DB.JoinChat(channelID, userID)
+	if err != nil {
+		return
+	}
+
+	// other tabs of the same user are already listed.
+	if joined {
+		r.publishChat(channelID, &model.UserJoined{ChannelID: channelID, CreatedAt: time.Now(), User: user})
+	}
+
+	// the beat only refreshes the listing, a ban that removed it keeps it gone.
+	heartbeat(ctx, func() {
+		database.DB.RefreshChat(channelID, userID)
+	}, func() {
+		if left, _ := database.DB.LeaveChat(channelID, userID); left {
+			r.publishChat(channelID, &model.UserLeft{ChannelID: channelID, CreatedAt: time.Now(), User: user})
+		}
+	})
+}
+
+// subscribeChat streams the events of channelID's chat as convert turns them
+// into T, skipping the ones it reports false for.
+func subscribeChat[T any](ctx context.Context, broker pubsub.Broker, channelID string, convert func(chatEvent) (T, bool)) (<-chan T, error) {
+	envelopes, err := subscribe[chatEvent](ctx, broker, chatTopic(channelID))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan T, 1)
+
+	go func() {
+		defer close(events)
+
+		for envelope := range envelopes {
+			event, ok := convert(envelope)
+			if !ok {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
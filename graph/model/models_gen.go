@@ -3,9 +3,18 @@
 package model
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
+type ChatEvent interface {
+	IsChatEvent()
+	GetChannelID() string
+	GetCreatedAt() time.Time
+}
+
 type Activity struct {
 	ID        string    `json:"id"`
 	Sender    *User     `json:"sender"`
@@ -18,20 +27,41 @@ type Activity struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+type AuthPayload struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	RefreshToken         string    `json:"refresh_token"`
+	Session              *Session  `json:"session"`
+}
+
 type Channel struct {
-	ID           string    `json:"id"`
-	Broadcaster  *User     `json:"broadcaster"`
-	UserID       string    `json:"user_id"`
-	Title        string    `json:"title"`
-	Notification string    `json:"notification"`
-	LivestreamID string    `json:"livestream_id"`
-	Category     string    `json:"category"`
-	Streamkey    string    `json:"streamkey"`
-	PlaybackID   string    `json:"playback_id"`
-	Tags         string    `json:"tags"`
-	IsBranded    bool      `json:"is_branded"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID             string         `json:"id"`
+	Broadcaster    *User          `json:"broadcaster"`
+	UserID         string         `json:"user_id"`
+	Title          string         `json:"title"`
+	Notification   string         `json:"notification"`
+	LivestreamID   string         `json:"livestream_id"`
+	Category       string         `json:"category"`
+	Streamkey      string         `json:"streamkey"`
+	PlaybackID     string         `json:"playback_id"`
+	PlaybackPolicy PlaybackPolicy `json:"playback_policy"`
+	Tags           string         `json:"tags"`
+	IsBranded      bool           `json:"is_branded"`
+	IsLive         bool           `json:"is_live"`
+	WentLiveAt     *time.Time     `json:"went_live_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+type ChannelBan struct {
+	ID          string     `json:"id"`
+	ChannelID   string     `json:"channel_id"`
+	UserID      string     `json:"user_id"`
+	User        *User      `json:"user"`
+	ModeratorID string     `json:"moderator_id"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 type ChannelFlakes struct {
@@ -49,14 +79,14 @@ type ChannelFlakesLeaders struct {
 }
 
 type ChannelInput struct {
-	BroadcasterID string `json:"broadcaster_id"`
-	Title         string `json:"title"`
-	Notification  string `json:"notification"`
-	Category      string `json:"category"`
-	Streamkey     string `json:"streamkey"`
-	PlaybackID    string `json:"playback_id"`
-	Tags          string `json:"tags"`
-	IsBranded     bool   `json:"is_branded"`
+	BroadcasterID string  `json:"broadcaster_id"`
+	Title         string  `json:"title"`
+	Notification  string  `json:"notification"`
+	Category      string  `json:"category"`
+	Streamkey     *string `json:"streamkey,omitempty"`
+	PlaybackID    *string `json:"playback_id,omitempty"`
+	Tags          string  `json:"tags"`
+	IsBranded     bool    `json:"is_branded"`
 }
 
 type ChannelViewer struct {
@@ -83,6 +113,35 @@ type ChatIdentityInput struct {
 	Badge string `json:"badge"`
 }
 
+type ChatSettings struct {
+	ChannelID          string    `json:"channel_id"`
+	SlowModeSeconds    int       `json:"slow_mode_seconds"`
+	FollowerOnly       bool      `json:"follower_only"`
+	FollowerMinMinutes int       `json:"follower_min_minutes"`
+	MemberOnly         bool      `json:"member_only"`
+	EmoteOnly          bool      `json:"emote_only"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type ChatSettingsChanged struct {
+	ChannelID string        `json:"channel_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	Settings  *ChatSettings `json:"settings"`
+	Summary   string        `json:"summary"`
+}
+
+func (ChatSettingsChanged) IsChatEvent()                 {}
+func (this ChatSettingsChanged) GetChannelID() string    { return this.ChannelID }
+func (this ChatSettingsChanged) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type ChatSettingsInput struct {
+	SlowModeSeconds    int  `json:"slow_mode_seconds"`
+	FollowerOnly       bool `json:"follower_only"`
+	FollowerMinMinutes int  `json:"follower_min_minutes"`
+	MemberOnly         bool `json:"member_only"`
+	EmoteOnly          bool `json:"emote_only"`
+}
+
 type Flakes struct {
 	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
@@ -90,6 +149,45 @@ type Flakes struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type FlakesDrop struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	Pool      int       `json:"pool"`
+	PerClaim  int       `json:"per_claim"`
+	MaxClaims int       `json:"max_claims"`
+	Claims    int       `json:"claims"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FlakesDropInput struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Pool      int    `json:"pool"`
+	MaxClaims int    `json:"max_claims"`
+	Duration  int    `json:"duration"`
+}
+
+type FlakesLedgerEntry struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Delta       int       `json:"delta"`
+	Balance     int       `json:"balance"`
+	Kind        string    `json:"kind"`
+	ReferenceID string    `json:"reference_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type FlakesPack struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Flakes     int    `json:"flakes"`
+	PriceCents int    `json:"price_cents"`
+	Currency   string `json:"currency"`
+}
+
 type FollowInput struct {
 	UserID     string `json:"user_id"`
 	FollowerID string `json:"follower_id"`
@@ -130,15 +228,18 @@ type Logs struct {
 }
 
 type Membership struct {
-	ID        string    `json:"id"`
-	ChannelID string    `json:"channel_id"`
-	UserID    string    `json:"user_id"`
-	Gifter    string    `json:"gifter"`
-	IsGift    bool      `json:"is_gift"`
-	Tier      string    `json:"tier"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                string     `json:"id"`
+	ChannelID         string     `json:"channel_id"`
+	UserID            string     `json:"user_id"`
+	Gifter            string     `json:"gifter"`
+	IsGift            bool       `json:"is_gift"`
+	Tier              string     `json:"tier"`
+	IsActive          bool       `json:"is_active"`
+	Status            string     `json:"status"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
 type MembershipDetails struct {
@@ -149,6 +250,8 @@ type MembershipDetails struct {
 	Description string    `json:"description"`
 	Badges      []string  `json:"badges"`
 	Cost        string    `json:"cost"`
+	PriceCents  int       `json:"price_cents"`
+	Currency    string    `json:"currency"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -162,19 +265,87 @@ type MembershipDetailsInput struct {
 }
 
 type Message struct {
-	ID                   string    `json:"id"`
-	ChannelID            string    `json:"channel_id"`
-	SenderID             string    `json:"sender_id"`
-	Sender               *User     `json:"sender"`
-	IsSent               bool      `json:"is_sent"`
-	Message              string    `json:"message"`
-	MessageType          string    `json:"message_type"`
-	Amount               int       `json:"amount"`
-	DropCode             string    `json:"drop_code"`
-	DropMessage          string    `json:"drop_message"`
-	ReplyParentMessageID string    `json:"reply_parent_message_id"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                   string           `json:"id"`
+	ChannelID            string           `json:"channel_id"`
+	SenderID             string           `json:"sender_id"`
+	Sender               *User            `json:"sender"`
+	IsSent               bool             `json:"is_sent"`
+	Message              string           `json:"message"`
+	MessageType          string           `json:"message_type"`
+	Amount               int              `json:"amount"`
+	DropCode             string           `json:"drop_code"`
+	DropMessage          string           `json:"drop_message"`
+	ReplyParentMessageID string           `json:"reply_parent_message_id"`
+	ReplyParent          *Message         `json:"replyParent,omitempty"`
+	ReplyCount           int              `json:"replyCount"`
+	Reactions            []*ReactionCount `json:"reactions"`
+	IsDeleted            bool             `json:"is_deleted"`
+	IsPinned             bool             `json:"is_pinned"`
+	Event                MessageEvent     `json:"event"`
+	CreatedAt            time.Time        `json:"created_at"`
+	UpdatedAt            time.Time        `json:"updated_at"`
+}
+
+type MessageCreated struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Message   *Message  `json:"message"`
+}
+
+func (MessageCreated) IsChatEvent()                 {}
+func (this MessageCreated) GetChannelID() string    { return this.ChannelID }
+func (this MessageCreated) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type MessageDeleted struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	MessageID string    `json:"message_id"`
+	DeletedBy string    `json:"deleted_by"`
+	Message   *Message  `json:"message"`
+}
+
+func (MessageDeleted) IsChatEvent()                 {}
+func (this MessageDeleted) GetChannelID() string    { return this.ChannelID }
+func (this MessageDeleted) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type MessagePinned struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Pinned    bool      `json:"pinned"`
+	Message   *Message  `json:"message"`
+}
+
+func (MessagePinned) IsChatEvent()                 {}
+func (this MessagePinned) GetChannelID() string    { return this.ChannelID }
+func (this MessagePinned) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type MessageReactionsChanged struct {
+	ChannelID string           `json:"channel_id"`
+	CreatedAt time.Time        `json:"created_at"`
+	MessageID string           `json:"message_id"`
+	Reactions []*ReactionCount `json:"reactions"`
+	Message   *Message         `json:"message"`
+}
+
+func (MessageReactionsChanged) IsChatEvent()                 {}
+func (this MessageReactionsChanged) GetChannelID() string    { return this.ChannelID }
+func (this MessageReactionsChanged) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type MessageSearchInput struct {
+	Query  *string    `json:"query,omitempty"`
+	Sender *string    `json:"sender,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+type MessagesEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Message `json:"node"`
+}
+
+type MessagesResult struct {
+	Edges    []*MessagesEdge `json:"edges"`
+	PageInfo *PageInfo       `json:"pageInfo"`
 }
 
 type Mutation struct {
@@ -190,13 +361,14 @@ type NewMembership struct {
 }
 
 type NewMessage struct {
-	ChannelID            string `json:"channel_id"`
-	SenderID             string `json:"sender_id"`
-	Message              string `json:"message"`
-	MessageType          string `json:"message_type"`
-	Amount               int    `json:"amount"`
-	IsSent               bool   `json:"is_sent"`
-	ReplyParentMessageID string `json:"reply_parent_message_id"`
+	ChannelID            string  `json:"channel_id"`
+	SenderID             string  `json:"sender_id"`
+	Message              string  `json:"message"`
+	MessageType          string  `json:"message_type"`
+	Amount               int     `json:"amount"`
+	IsSent               bool    `json:"is_sent"`
+	ReplyParentMessageID string  `json:"reply_parent_message_id"`
+	IdempotencyKey       *string `json:"idempotency_key,omitempty"`
 }
 
 type NewPostInput struct {
@@ -255,6 +427,38 @@ type PaymentInput struct {
 	Status  string `json:"status"`
 }
 
+type Payout struct {
+	ID            string    `json:"id"`
+	ChannelID     string    `json:"channel_id"`
+	Flakes        int       `json:"flakes"`
+	GrossCents    int       `json:"gross_cents"`
+	FeeCents      int       `json:"fee_cents"`
+	AmountCents   int       `json:"amount_cents"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status"`
+	FailureReason string    `json:"failure_reason"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type PayoutBalance struct {
+	Flakes         int  `json:"flakes"`
+	GrossCents     int  `json:"gross_cents"`
+	FeeCents       int  `json:"fee_cents"`
+	AmountCents    int  `json:"amount_cents"`
+	MinimumCents   int  `json:"minimum_cents"`
+	PayoutsEnabled bool `json:"payouts_enabled"`
+}
+
+type PlaybackToken struct {
+	PlaybackID      string         `json:"playback_id"`
+	Policy          PlaybackPolicy `json:"policy"`
+	Token           string         `json:"token"`
+	ThumbnailToken  string         `json:"thumbnail_token"`
+	StoryboardToken string         `json:"storyboard_token"`
+	ExpiresAt       *time.Time     `json:"expires_at,omitempty"`
+}
+
 type Post struct {
 	ID        string    `json:"id"`
 	Author    string    `json:"author"`
@@ -280,9 +484,46 @@ type PostsResult struct {
 type Query struct {
 }
 
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Device     string    `json:"device"`
+	Current    bool      `json:"current"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Subscription struct {
 }
 
+type SupportRequest struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Message   string    `json:"message"`
+	Image     string    `json:"image"`
+	Resolved  bool      `json:"resolved"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type TipReceived struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Sender    *User     `json:"sender"`
+	Amount    int       `json:"amount"`
+	Message   *Message  `json:"message"`
+}
+
+func (TipReceived) IsChatEvent()                 {}
+func (this TipReceived) GetChannelID() string    { return this.ChannelID }
+func (this TipReceived) GetCreatedAt() time.Time { return this.CreatedAt }
+
 type Token struct {
 	ID        string     `json:"id"`
 	UserID    string     `json:"user_id"`
@@ -327,6 +568,45 @@ type User struct {
 	UpdatedAt           time.Time     `json:"updated_at"`
 }
 
+type UserDetails struct {
+	MobilePushToken        string `json:"mobile_push_token"`
+	LiveEmailNotifications bool   `json:"live_email_notifications"`
+}
+
+type UserDetailsInput struct {
+	MobilePushToken        string `json:"mobile_push_token"`
+	LiveEmailNotifications bool   `json:"live_email_notifications"`
+}
+
+type UserJoined struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      *User     `json:"user"`
+}
+
+func (UserJoined) IsChatEvent()                 {}
+func (this UserJoined) GetChannelID() string    { return this.ChannelID }
+func (this UserJoined) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type UserLeft struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      *User     `json:"user"`
+}
+
+func (UserLeft) IsChatEvent()                 {}
+func (this UserLeft) GetChannelID() string    { return this.ChannelID }
+func (this UserLeft) GetCreatedAt() time.Time { return this.CreatedAt }
+
+type UserRole struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Role      Role      `json:"role"`
+	ChannelID string    `json:"channel_id"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type UserStripeInput struct {
 	StripeCustomerID    string `json:"stripe_customer_id"`
 	StripeConnectedLink bool   `json:"stripe_connected_link"`
@@ -345,21 +625,24 @@ type UsersInChatInput struct {
 }
 
 type Video struct {
-	ID        string    `json:"id"`
-	ChannelID string    `json:"channel_id"`
-	Title     string    `json:"title"`
-	Caption   string    `json:"caption"`
-	Category  string    `json:"category"`
-	Poster    string    `json:"poster"`
-	Thumbnail string    `json:"thumbnail"`
-	Media     string    `json:"media"`
-	JobID     string    `json:"job_id"`
-	Tier      int       `json:"tier"`
-	Views     int       `json:"views"`
-	IsPremium bool      `json:"isPremium"`
-	IsVisible bool      `json:"isVisible"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             string         `json:"id"`
+	ChannelID      string         `json:"channel_id"`
+	Title          string         `json:"title"`
+	Caption        string         `json:"caption"`
+	Category       string         `json:"category"`
+	Poster         string         `json:"poster"`
+	Thumbnail      string         `json:"thumbnail"`
+	Media          string         `json:"media"`
+	JobID          string         `json:"job_id"`
+	Tier           int            `json:"tier"`
+	Views          int            `json:"views"`
+	IsPremium      bool           `json:"isPremium"`
+	IsVisible      bool           `json:"isVisible"`
+	IsLocked       bool           `json:"isLocked"`
+	PlaybackID     string         `json:"playback_id"`
+	PlaybackPolicy PlaybackPolicy `json:"playback_policy"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
 }
 
 type VideoJob struct {
@@ -390,3 +673,188 @@ type VideosResult struct {
 	Edges    []*VideosEdge `json:"edges"`
 	PageInfo *PageInfo     `json:"pageInfo"`
 }
+
+type Waitlist struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	CanEnter  bool      `json:"can_enter"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MessageEvent string
+
+const (
+	MessageEventCreated          MessageEvent = "CREATED"
+	MessageEventDeleted          MessageEvent = "DELETED"
+	MessageEventReactionsChanged MessageEvent = "REACTIONS_CHANGED"
+	MessageEventPinned           MessageEvent = "PINNED"
+	MessageEventUnpinned         MessageEvent = "UNPINNED"
+)
+
+var AllMessageEvent = []MessageEvent{
+	MessageEventCreated,
+	MessageEventDeleted,
+	MessageEventReactionsChanged,
+	MessageEventPinned,
+	MessageEventUnpinned,
+}
+
+func (e MessageEvent) IsValid() bool {
+	switch e {
+	case MessageEventCreated, MessageEventDeleted, MessageEventReactionsChanged, MessageEventPinned, MessageEventUnpinned:
+		return true
+	}
+	return false
+}
+
+func (e MessageEvent) String() string {
+	return string(e)
+}
+
+func (e *MessageEvent) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MessageEvent(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MessageEvent", str)
+	}
+	return nil
+}
+
+func (e MessageEvent) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OwnedEntity string
+
+const (
+	OwnedEntityUser       OwnedEntity = "USER"
+	OwnedEntityPost       OwnedEntity = "POST"
+	OwnedEntityVideo      OwnedEntity = "VIDEO"
+	OwnedEntityMembership OwnedEntity = "MEMBERSHIP"
+)
+
+var AllOwnedEntity = []OwnedEntity{
+	OwnedEntityUser,
+	OwnedEntityPost,
+	OwnedEntityVideo,
+	OwnedEntityMembership,
+}
+
+func (e OwnedEntity) IsValid() bool {
+	switch e {
+	case OwnedEntityUser, OwnedEntityPost, OwnedEntityVideo, OwnedEntityMembership:
+		return true
+	}
+	return false
+}
+
+func (e OwnedEntity) String() string {
+	return string(e)
+}
+
+func (e *OwnedEntity) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OwnedEntity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OwnedEntity", str)
+	}
+	return nil
+}
+
+func (e OwnedEntity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PlaybackPolicy string
+
+const (
+	PlaybackPolicyPublic PlaybackPolicy = "PUBLIC"
+	PlaybackPolicySigned PlaybackPolicy = "SIGNED"
+)
+
+var AllPlaybackPolicy = []PlaybackPolicy{
+	PlaybackPolicyPublic,
+	PlaybackPolicySigned,
+}
+
+func (e PlaybackPolicy) IsValid() bool {
+	switch e {
+	case PlaybackPolicyPublic, PlaybackPolicySigned:
+		return true
+	}
+	return false
+}
+
+func (e PlaybackPolicy) String() string {
+	return string(e)
+}
+
+func (e *PlaybackPolicy) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PlaybackPolicy(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PlaybackPolicy", str)
+	}
+	return nil
+}
+
+func (e PlaybackPolicy) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleAdmin     Role = "ADMIN"
+	RoleSupport   Role = "SUPPORT"
+	RoleModerator Role = "MODERATOR"
+	RoleEditor    Role = "EDITOR"
+)
+
+var AllRole = []Role{
+	RoleAdmin,
+	RoleSupport,
+	RoleModerator,
+	RoleEditor,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleAdmin, RoleSupport, RoleModerator, RoleEditor:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
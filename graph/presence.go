@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/glitchd/glitchd-server/graph/model"
+)
+
+// heartbeat calls beat every database.PresenceHeartbeat until ctx is done,
+// then calls leave.
+func heartbeat(ctx context.Context, beat func(), leave func()) {
+	go func() {
+		ticker := time.NewTicker(database.PresenceHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				leave()
+				return
+			case <-ticker.C:
+				beat()
+			}
+		}
+	}()
+}
+
+// publishChannelViewers sends the live viewer count of channelID to its
+// getChannelViewers subscribers.
+func (r *Resolver) publishChannelViewers(channelID string) {
+	count, err := database.DB.GetChannelViewers(channelID)
+	if err != nil {
+		return
+	}
+
+	r.publish(channelViewersTopic(channelID), count)
+}
+
+// SweepPresence drops chat users and channel viewers whose heartbeats stopped,
+// right away to reconcile what a previous run left behind and then every
+// interval until ctx is done. Subscribers hear about it like about any other
+// part.
+func (r *Resolver) SweepPresence(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.expirePresence()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Resolver) expirePresence() {
+	left, channels, err := database.DB.ExpirePresence()
+	if err != nil {
+		return
+	}
+
+	if len(left) > 0 || len(channels) > 0 {
+		fmt.Println("Expired stale presence: ", len(left), " chat users, ", len(channels), " channels")
+	}
+
+	now := time.Now()
+
+	for _, entry := range left {
+		user, err := database.DB.GetUser(entry.UserID)
+		if err != nil {
+			continue
+		}
+
+		r.publishChat(entry.ChannelID, &model.UserLeft{ChannelID: entry.ChannelID, CreatedAt: now, User: user})
+	}
+
+	for _, channelID := range channels {
+		r.publishChannelViewers(channelID)
+	}
+}
@@ -1,10 +1,19 @@
 package graph
 
 import (
-	"math/rand"
-	"sync"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/glitchd/glitchd-server/database"
 	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/middlewares"
+	"github.com/glitchd/glitchd-server/notifications"
+	"github.com/glitchd/glitchd-server/playback"
+	"github.com/glitchd/glitchd-server/pubsub"
+	"github.com/google/uuid"
 )
 
 // This file will not be regenerated automatically.
@@ -12,166 +21,261 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	Rooms          sync.Map
-	Viewers        sync.Map
-	ChannelViewers sync.Map
-	Activity       sync.Map
-	Job            sync.Map
-	Post           sync.Map
+	Broker pubsub.Broker
+	// Playback signs tokens for SIGNED playback ids, nil when no Mux signing
+	// key is configured.
+	Playback *playback.Signer
+	// Live notifies followers when a channel goes live, nil to skip that.
+	Live *notifications.LiveNotifier
 }
 
-type ChatResolver struct {
-	ChatMessages *model.Message
-	ChatChannel  string
-	// All active subscriptions
-	ChatObservers map[string]chan *model.Message
-	mu            sync.Mutex
+func chatTopic(channelID string) string {
+	return "chat:" + channelID
 }
 
-type Observer struct {
-	ChannelID string
-	Message   chan *model.Message
+func videoViewersTopic(videoID string) string {
+	return "video_viewers:" + videoID
 }
 
-type Chatroom struct {
-	ChannelID string
-	Message   *model.Message
-	Observers sync.Map
+func channelViewersTopic(channelID string) string {
+	return "channel_viewers:" + channelID
 }
 
-type VideoResolver struct {
-	VideoID        string
-	VideoViewers   *int
-	VideoObservers map[string]chan *int
-	mu             sync.Mutex
+func activityTopic(channelID string) string {
+	return "activity:" + channelID
 }
 
-type VideoObserver struct {
-	VideoID string
-	Count   chan int
+func jobTopic(jobID string) string {
+	return "job:" + jobID
 }
 
-type VideoPage struct {
-	VideoID   string
-	Count     int
-	Observers sync.Map
+func feedTopic(userID string) string {
+	return "feed:" + userID
 }
 
-type ChannelObserver struct {
-	ChannelID string
-	Count     chan int
+func profileTopic(userID string) string {
+	return "profile:" + userID
 }
 
-type ChannelPage struct {
-	ChannelID string
-	Count     int
-	Observers sync.Map
-}
+// playbackToken signs the tokens a player needs for playbackID. Public ids
+// play without tokens.
+func (r *Resolver) playbackToken(playbackID string, policy model.PlaybackPolicy) (*model.PlaybackToken, error) {
+	result := &model.PlaybackToken{PlaybackID: playbackID, Policy: policy}
 
-type JobObserver struct {
-	JobID  string
-	Status chan string
-}
+	if policy != model.PlaybackPolicySigned {
+		return result, nil
+	}
 
-type JobPage struct {
-	JobID     string
-	Status    string
-	Observers sync.Map
-}
+	if r.Playback == nil {
+		return nil, playback.ErrNotConfigured
+	}
 
-type ActivityResolver struct {
-	ChannelID         string
-	Activity          *model.Activity
-	ActivityObservers sync.Map
-}
+	var err error
 
-type ActivityObserver struct {
-	ChannelID string
-	Activity  chan *model.Activity
-}
+	if result.Token, err = r.Playback.Sign(playbackID, playback.Video); err != nil {
+		return nil, err
+	}
 
-type ActivityPage struct {
-	ChannelID string
-	Activity  *model.Activity
-	Observers sync.Map
+	if result.ThumbnailToken, err = r.Playback.Sign(playbackID, playback.Thumbnail); err != nil {
+		return nil, err
+	}
+
+	if result.StoryboardToken, err = r.Playback.Sign(playbackID, playback.Storyboard); err != nil {
+		return nil, err
+	}
+
+	expiresAt := r.Playback.ExpiresAt()
+	result.ExpiresAt = &expiresAt
+
+	return result, nil
 }
 
-type PostsResolver struct {
-	ChannelID      string
-	Post           *model.Post
-	PostsObservers sync.Map
+// publish encodes event and sends it to every subscriber of topic. Failures are
+// logged rather than returned so a broken broker never fails the mutation that
+// triggered the event.
+func (r *Resolver) publish(topic string, event any) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("Could not encode event for topic "+topic+": ", err)
+		return
+	}
+
+	if err := r.Broker.Publish(context.Background(), topic, payload); err != nil {
+		fmt.Println("Could not publish event to topic "+topic+": ", err)
+	}
 }
 
-type PostObserver struct {
-	ChannelID string
-	Post      chan *model.Post
+// publishPost pushes a new post to its author's profile stream and to the feed of
+// everyone following the author.
+func (r *Resolver) publishPost(post *model.Post) {
+	r.publish(profileTopic(post.Author), post)
+
+	followers, err := database.DB.GetFollowerIDs(post.Author)
+	if err != nil {
+		return
+	}
+
+	for _, followerID := range followers {
+		r.publish(feedTopic(followerID), post)
+	}
 }
 
-type PostPage struct {
-	ChannelID string
-	Post      *model.Post
-	Observers sync.Map
+// publishUserLeft tells the chat of channelID that userID is not listed in it
+// anymore.
+func (r *Resolver) publishUserLeft(channelID string, userID string) {
+	user, err := database.DB.GetUser(userID)
+	if err != nil {
+		return
+	}
+
+	r.publishChat(channelID, &model.UserLeft{ChannelID: channelID, CreatedAt: time.Now(), User: user})
 }
 
-func (r *Resolver) getRoom(channelID string) *Chatroom {
-	room, _ := r.Rooms.LoadOrStore(channelID, &Chatroom{
+// publishSystemMessage posts a message made by the server, like a ban or a
+// gift, to the chat of channelID. Clients tell them apart by kind.
+func (r *Resolver) publishSystemMessage(channelID string, userID string, kind string, reason string, seconds int) {
+	user, err := database.DB.GetUser(userID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+
+	r.publishChat(channelID, &model.MessageCreated{
 		ChannelID: channelID,
-		Observers: sync.Map{},
+		CreatedAt: now,
+		Message: &model.Message{
+			ID:          uuid.New().String(),
+			ChannelID:   channelID,
+			SenderID:    userID,
+			Sender:      user,
+			Message:     reason,
+			MessageType: kind,
+			Amount:      seconds,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
 	})
-	return room.(*Chatroom)
 }
 
-func (r *Resolver) getVideoViewers(videoID string) *VideoPage {
-	page, _ := r.Viewers.LoadOrStore(videoID, &VideoPage{
-		VideoID: videoID,
-		Count:   0,
-	})
+// AnnounceGift lets the channel know that memberships were gifted, both as an
+// activity and as a message in chat.
+func (r *Resolver) AnnounceGift(gift *database.MembershipGift) {
+	names := make([]string, 0, len(gift.Recipients))
+	for _, recipient := range gift.Recipients {
+		names = append(names, recipient.Username)
+	}
 
-	return page.(*VideoPage)
-}
+	message := fmt.Sprintf("Gifted %d Tier %s memberships", len(gift.Recipients), gift.Tier)
 
-func (r *Resolver) getChannelViewers(channelID string) *ChannelPage {
-	page, _ := r.ChannelViewers.LoadOrStore(channelID, &ChannelPage{
-		ChannelID: channelID,
-		Count:     0,
-	})
+	act, err := database.DB.CreateActivity(gift.GifterID, gift.ChannelID, "gift", message)
+	if err == nil {
+		act.Sender, _ = database.DB.GetUser(act.SenderID)
+		act.Target, _ = database.DB.GetUser(act.TargetID)
+
+		r.publish(activityTopic(gift.ChannelID), act)
+	}
+
+	if len(names) > 0 {
+		message += " to " + strings.Join(names, ", ")
+	}
+
+	if gift.Unassigned > 0 {
+		message += fmt.Sprintf(", %d found no viewer to go to", gift.Unassigned)
+	}
 
-	return page.(*ChannelPage)
+	r.publishSystemMessage(gift.ChannelID, gift.GifterID, "gift", message, len(gift.Recipients))
 }
 
-func (r *Resolver) getJobStatus(jobID string) *JobPage {
-	page, _ := r.Job.LoadOrStore(jobID, &JobPage{
-		JobID:     jobID,
-		Observers: sync.Map{},
-	})
+// PublishVideoJob tells the clients waiting on job_id about its new status.
+func (r *Resolver) PublishVideoJob(job_id string, status string) {
+	r.publish(jobTopic(job_id), status)
+}
 
-	return page.(*JobPage)
+// AnnounceLive queues the go-live notifications for the followers of
+// channel_id.
+func (r *Resolver) AnnounceLive(channel_id string) {
+	if r.Live != nil {
+		r.Live.GoLive(channel_id)
+	}
 }
 
-func (r *Resolver) getChannelActivity(channelID string) *ActivityPage {
-	page, _ := r.Activity.LoadOrStore(channelID, &ActivityPage{
-		ChannelID: channelID,
-		Observers: sync.Map{},
-	})
+// viewerID returns the id of the signed in user, or "" for anonymous viewers.
+func viewerID(ctx context.Context) string {
+	if claim := middlewares.CtxValue(ctx); claim != nil {
+		return claim.ID
+	}
 
-	return page.(*ActivityPage)
+	return ""
 }
 
-func (r *Resolver) getPosts(channelID string) *PostPage {
-	page, _ := r.Post.LoadOrStore(channelID, &PostPage{
-		ChannelID: channelID,
-		Observers: sync.Map{},
-	})
+// stringValue returns the value of an optional string argument.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
 
-	return page.(*PostPage)
+	return *s
 }
 
-var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+// chatSettingsSummary describes the active chat modes in a way that can be
+// shown to viewers.
+func chatSettingsSummary(settings *model.ChatSettings) string {
+	modes := []string{}
+
+	if settings.SlowModeSeconds > 0 {
+		modes = append(modes, fmt.Sprintf("slow mode (%ds)", settings.SlowModeSeconds))
+	}
 
-func randString(n int) string {
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+	if settings.FollowerOnly {
+		if settings.FollowerMinMinutes > 0 {
+			modes = append(modes, fmt.Sprintf("follower-only (%dm)", settings.FollowerMinMinutes))
+		} else {
+			modes = append(modes, "follower-only")
+		}
 	}
-	return string(b)
+
+	if settings.MemberOnly {
+		modes = append(modes, "member-only")
+	}
+
+	if settings.EmoteOnly {
+		modes = append(modes, "emote-only")
+	}
+
+	if len(modes) == 0 {
+		return "Chat modes turned off"
+	}
+
+	return "Chat is now in " + strings.Join(modes, ", ") + " mode"
+}
+
+// subscribe decodes every payload published on topic into T until ctx is done.
+func subscribe[T any](ctx context.Context, broker pubsub.Broker, topic string) (<-chan T, error) {
+	payloads, err := broker.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan T, 1)
+
+	go func() {
+		defer close(events)
+
+		for payload := range payloads {
+			var event T
+			if err := json.Unmarshal(payload, &event); err != nil {
+				fmt.Println("Could not decode event from topic "+topic+": ", err)
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
 }
@@ -8,11 +8,41 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/glitchd/glitchd-server/database"
 	"github.com/glitchd/glitchd-server/graph/model"
+	"github.com/glitchd/glitchd-server/middlewares"
 )
 
+// Streamkey is the resolver for the streamkey field.
+func (r *channelResolver) Streamkey(ctx context.Context, obj *model.Channel) (string, error) {
+	if viewerID(ctx) != obj.UserID {
+		return "", nil
+	}
+
+	return obj.Streamkey, nil
+}
+
+// Reactions is the resolver for the reactions field.
+func (r *messageResolver) Reactions(ctx context.Context, obj *model.Message) ([]*model.ReactionCount, error) {
+	// reactions are loaded with the message, a new message has none yet.
+	if obj.Reactions == nil {
+		return []*model.ReactionCount{}, nil
+	}
+
+	return obj.Reactions, nil
+}
+
+// Event is the resolver for the event field.
+func (r *messageResolver) Event(ctx context.Context, obj *model.Message) (model.MessageEvent, error) {
+	if obj.Event == "" {
+		return model.MessageEventCreated, nil
+	}
+
+	return obj.Event, nil
+}
+
 // CreateLog is the resolver for the createLog field.
 func (r *mutationResolver) CreateLog(ctx context.Context, data string) (bool, error) {
 	return database.DB.CreateLog(data)
@@ -48,6 +78,11 @@ func (r *mutationResolver) DeleteUser(ctx context.Context, id string) (bool, err
 	return database.DB.DeleteUser(id)
 }
 
+// UpdateUserDetails is the resolver for the updateUserDetails field.
+func (r *mutationResolver) UpdateUserDetails(ctx context.Context, id string, input model.UserDetailsInput) (*model.UserDetails, error) {
+	return database.DB.UpdateUserDetails(id, input)
+}
+
 // Login is the resolver for the login field.
 func (r *mutationResolver) Login(ctx context.Context, email string) (string, error) {
 	return database.DB.LoginAccount(email)
@@ -55,7 +90,31 @@ func (r *mutationResolver) Login(ctx context.Context, email string) (string, err
 
 // VerifyToken is the resolver for the verifyToken field.
 func (r *mutationResolver) VerifyToken(ctx context.Context, id string, token string) (string, error) {
-	return database.DB.VerifyToken(id, token)
+	return database.DB.VerifyToken(id, token, middlewares.IPValue(ctx))
+}
+
+// VerifyLogin is the resolver for the verifyLogin field.
+func (r *mutationResolver) VerifyLogin(ctx context.Context, id string, token string, device string) (*model.AuthPayload, error) {
+	return database.DB.VerifyLogin(id, token, device, middlewares.IPValue(ctx))
+}
+
+// RefreshSession is the resolver for the refreshSession field.
+func (r *mutationResolver) RefreshSession(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
+	return database.DB.RefreshSession(refreshToken)
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	return database.DB.RevokeSession(claim.ID, id)
+}
+
+// RevokeAllSessions is the resolver for the revokeAllSessions field.
+func (r *mutationResolver) RevokeAllSessions(ctx context.Context) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	return database.DB.RevokeAllSessions(claim.ID)
 }
 
 // VerifyEmail is the resolver for the verifyEmail field.
@@ -70,23 +129,16 @@ func (r *mutationResolver) CreateChannel(ctx context.Context, userID string, inp
 
 // CreateChannelViewer is the resolver for the createChannelViewer field.
 func (r *mutationResolver) CreateChannelViewer(ctx context.Context, channelID string, userID string) (int, error) {
-	viewer := r.getChannelViewers(channelID)
-
-	viewer.Count = viewer.Count + 1
-
 	res, err := database.DB.CreateChannelViewer(channelID, userID)
 
-	// Notify all active subscriptions that a new message has been posted by posted. In this case we push the now
-	// updated ChatMessages to all clients that care about it.
-	viewer.Observers.Range(func(_, v any) bool {
-		observer := v.(*ChannelObserver)
+	if err != nil {
+		return res, err
+	}
+
+	// Notify all active subscriptions that a new viewer has joined the channel.
+	r.publish(channelViewersTopic(channelID), res)
 
-		if observer.ChannelID == channelID {
-			observer.Count <- 1
-		}
-		return true
-	})
-	return res, err
+	return res, nil
 }
 
 // UpdateStreamKey is the resolver for the updateStreamKey field.
@@ -94,62 +146,245 @@ func (r *mutationResolver) UpdateStreamKey(ctx context.Context, userID string, s
 	return database.DB.UpdateStreamkey(userID, streamkey, playbackID)
 }
 
+// ResetStreamKey is the resolver for the resetStreamKey field.
+func (r *mutationResolver) ResetStreamKey(ctx context.Context, userID string) (*model.Channel, error) {
+	return database.DB.ResetStreamKey(userID)
+}
+
+// SetChannelPlaybackPolicy is the resolver for the setChannelPlaybackPolicy field.
+func (r *mutationResolver) SetChannelPlaybackPolicy(ctx context.Context, channelID string, policy model.PlaybackPolicy) (*model.Channel, error) {
+	return database.DB.SetChannelPlaybackPolicy(channelID, policy)
+}
+
 // PostMessage is the resolver for the postMessage field.
 func (r *mutationResolver) PostMessage(ctx context.Context, input *model.NewMessage) (*model.Message, error) {
-	activity := r.getChannelActivity(input.ChannelID)
-	room := r.getRoom(input.ChannelID)
+	// a retried tip is answered with the message of the first call, even when
+	// a chat mode would hold back a new one.
+	if input.MessageType == "flakes" && stringValue(input.IdempotencyKey) != "" {
+		msg, err := database.DB.GetTipMessage(input.ChannelID, input.SenderID, *input.IdempotencyKey)
 
-	msg, err := database.DB.CreateMessage(input)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+
+	if err := database.DB.CheckBan(input.ChannelID, input.SenderID); err != nil {
+		return nil, err
+	}
+
+	// tips are paid for, emote-only and slow mode don't hold them back.
+	slow, err := database.DB.CheckChatModes(input.ChannelID, input.SenderID, input.Message, input.MessageType == "flakes")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *model.Message
+
+	// replies have to stay within the chat they answer.
+	if input.ReplyParentMessageID != "" {
+		parent, err = database.DB.GetMessage(input.ChannelID, input.ReplyParentMessageID)
+
+		if err != nil {
+			return nil, err
+		}
 
+		if parent.IsDeleted {
+			return nil, database.ErrMessageNotFound
+		}
+	}
+
+	var msg *model.Message
+
+	// Flakes are taken together with storing the message so a failed tip never shows up in chat.
 	if input.MessageType == "flakes" {
-		isSent, err := database.DB.SendFlakes(input.ChannelID, input.SenderID, input.Amount)
+		var isSent bool
+
+		msg, isSent, err = database.DB.SendFlakes(input, stringValue(input.IdempotencyKey))
 
 		if err != nil {
 			return nil, err
 		}
 
+		// a retry gets the message of the first call without announcing it again.
 		if !isSent {
-			return nil, nil
+			return msg, nil
 		}
 
-		if isSent {
-			amount := strconv.Itoa(input.Amount)
+		amount := strconv.Itoa(input.Amount)
 
-			act, _ := database.DB.CreateActivity(input.SenderID, input.ChannelID, "flakes", "Sent you "+amount+" Flakes")
+		act, _ := database.DB.CreateActivity(input.SenderID, input.ChannelID, "flakes", "Sent you "+amount+" Flakes")
 
-			sender, _ := database.DB.GetUser(act.SenderID)
-			target, _ := database.DB.GetUser(act.TargetID)
+		sender, _ := database.DB.GetUser(act.SenderID)
+		target, _ := database.DB.GetUser(act.TargetID)
 
-			act.Sender = sender
-			act.Target = target
+		act.Sender = sender
+		act.Target = target
 
-			// Notify all active subscriptions that a new message has been posted by posted. In this case we push the now
-			// updated ChatMessages to all clients that care about it.
-			activity.Observers.Range(func(_, v any) bool {
-				observer := v.(*ActivityObserver)
+		// Notify all active subscriptions that the channel received flakes.
+		r.publish(activityTopic(input.ChannelID), act)
+	} else {
+		msg, err = database.DB.CreateMessage(input, slow)
 
-				if observer.ChannelID == activity.ChannelID {
-					observer.Activity <- act
-				}
-				return true
-			})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// append only the latest message if the channel id matches.
-	room.Message = msg
+	// the published message carries its parent so subscribers don't look it up.
+	msg.ReplyParent = parent
 
-	// Notify all active subscriptions that a new message has been posted by posted. In this case we push the now
-	// updated ChatMessages to all clients that care about it.
-	room.Observers.Range(func(_, v any) bool {
-		observer := v.(*Observer)
+	// Notify all active subscriptions that a new message has been posted. In this case we push the
+	// message to all clients that care about it.
+	if input.MessageType == "flakes" {
+		r.publishChat(msg.ChannelID, &model.TipReceived{ChannelID: msg.ChannelID, CreatedAt: msg.CreatedAt, Sender: msg.Sender, Amount: msg.Amount, Message: msg})
+	} else {
+		r.publishChat(msg.ChannelID, &model.MessageCreated{ChannelID: msg.ChannelID, CreatedAt: msg.CreatedAt, Message: msg})
+	}
 
-		if observer.ChannelID == msg.ChannelID {
-			observer.Message <- msg
-		}
-		return true
-	})
-	return msg, err
+	return msg, nil
+}
+
+// UpdateChatSettings is the resolver for the updateChatSettings field.
+func (r *mutationResolver) UpdateChatSettings(ctx context.Context, channelID string, input model.ChatSettingsInput) (*model.ChatSettings, error) {
+	settings, err := database.DB.UpdateChatSettings(channelID, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Let everyone in chat know which modes are now active. getMessages turns
+	// this into a "settings" system message.
+	r.publishChat(channelID, &model.ChatSettingsChanged{ChannelID: channelID, CreatedAt: time.Now(), Settings: settings, Summary: chatSettingsSummary(settings)})
+
+	return settings, nil
+}
+
+// BanUser is the resolver for the banUser field.
+func (r *mutationResolver) BanUser(ctx context.Context, channelID string, userID string, reason string) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	listed, _ := database.DB.IsUserInChat(channelID, userID)
+
+	banned, err := database.DB.BanUser(channelID, userID, claim.ID, reason, nil)
+
+	if err != nil || !banned {
+		return banned, err
+	}
+
+	// the ban took them off the chat's user list.
+	if listed {
+		r.publishUserLeft(channelID, userID)
+	}
+
+	r.publishSystemMessage(channelID, userID, "ban", reason, 0)
+
+	return true, nil
+}
+
+// TimeoutUser is the resolver for the timeoutUser field.
+func (r *mutationResolver) TimeoutUser(ctx context.Context, channelID string, userID string, duration int, reason string) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	if duration <= 0 {
+		return false, fmt.Errorf("duration must be positive")
+	}
+
+	expiresAt := time.Now().Add(time.Duration(duration) * time.Second)
+
+	listed, _ := database.DB.IsUserInChat(channelID, userID)
+
+	banned, err := database.DB.BanUser(channelID, userID, claim.ID, reason, &expiresAt)
+
+	if err != nil || !banned {
+		return banned, err
+	}
+
+	// the ban took them off the chat's user list.
+	if listed {
+		r.publishUserLeft(channelID, userID)
+	}
+
+	r.publishSystemMessage(channelID, userID, "timeout", reason, duration)
+
+	return true, nil
+}
+
+// UnbanUser is the resolver for the unbanUser field.
+func (r *mutationResolver) UnbanUser(ctx context.Context, channelID string, userID string) (bool, error) {
+	return database.DB.UnbanUser(channelID, userID)
+}
+
+// DeleteMessage is the resolver for the deleteMessage field.
+func (r *mutationResolver) DeleteMessage(ctx context.Context, channelID string, messageID string) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	msg, err := database.DB.DeleteMessage(channelID, messageID, claim.ID)
+
+	if err != nil {
+		return false, err
+	}
+
+	// Push the deleted message so clients can remove it from the chat.
+	msg.Event = model.MessageEventDeleted
+	r.publishChat(channelID, &model.MessageDeleted{ChannelID: channelID, CreatedAt: time.Now(), MessageID: msg.ID, DeletedBy: claim.ID, Message: msg})
+
+	return true, nil
+}
+
+// ReactToMessage is the resolver for the reactToMessage field.
+func (r *mutationResolver) ReactToMessage(ctx context.Context, channelID string, messageID string, emoji string) (*model.Message, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	if err := database.DB.CheckBan(channelID, claim.ID); err != nil {
+		return nil, err
+	}
+
+	msg, err := database.DB.AddReaction(channelID, messageID, claim.ID, emoji)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Event = model.MessageEventReactionsChanged
+	r.publishChat(channelID, &model.MessageReactionsChanged{ChannelID: channelID, CreatedAt: time.Now(), MessageID: msg.ID, Reactions: msg.Reactions, Message: msg})
+
+	return msg, nil
+}
+
+// RemoveReaction is the resolver for the removeReaction field.
+func (r *mutationResolver) RemoveReaction(ctx context.Context, channelID string, messageID string, emoji string) (*model.Message, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	msg, err := database.DB.RemoveReaction(channelID, messageID, claim.ID, emoji)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Event = model.MessageEventReactionsChanged
+	r.publishChat(channelID, &model.MessageReactionsChanged{ChannelID: channelID, CreatedAt: time.Now(), MessageID: msg.ID, Reactions: msg.Reactions, Message: msg})
+
+	return msg, nil
+}
+
+// PinMessage is the resolver for the pinMessage field.
+func (r *mutationResolver) PinMessage(ctx context.Context, channelID string, messageID string, pinned bool) (*model.Message, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	msg, err := database.DB.PinMessage(channelID, messageID, claim.ID, pinned)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Event = model.MessageEventUnpinned
+	if pinned {
+		msg.Event = model.MessageEventPinned
+	}
+	r.publishChat(channelID, &model.MessagePinned{ChannelID: channelID, CreatedAt: time.Now(), Pinned: pinned, Message: msg})
+
+	return msg, nil
 }
 
 // CreateVideo is the resolver for the createVideo field.
@@ -159,22 +394,11 @@ func (r *mutationResolver) CreateVideo(ctx context.Context, input model.NewVideo
 
 // CreateVideoView is the resolver for the createVideoView field.
 func (r *mutationResolver) CreateVideoView(ctx context.Context, input model.NewVideoView) (int, error) {
-	viewer := r.getVideoViewers(input.VideoID)
-
-	viewer.Count = viewer.Count + 1
-
 	res, err := database.DB.CreateVideoView(input)
 
-	// Notify all active subscriptions that a new message has been posted by posted. In this case we push the now
-	// updated ChatMessages to all clients that care about it.
-	viewer.Observers.Range(func(_, v any) bool {
-		observer := v.(*VideoObserver)
+	// Notify all active subscriptions that the video has a new view.
+	r.publish(videoViewersTopic(input.VideoID), 1)
 
-		if observer.VideoID == input.VideoID {
-			observer.Count <- 1
-		}
-		return true
-	})
 	return res, err
 }
 
@@ -188,27 +412,30 @@ func (r *mutationResolver) DeleteVideo(ctx context.Context, id string) (bool, er
 	return database.DB.DeleteVideo(id)
 }
 
+// SetVideoPlaybackPolicy is the resolver for the setVideoPlaybackPolicy field.
+func (r *mutationResolver) SetVideoPlaybackPolicy(ctx context.Context, id string, policy model.PlaybackPolicy) (*model.Video, error) {
+	return database.DB.SetVideoPlaybackPolicy(id, policy)
+}
+
 // UpdateVideoJob is the resolver for the updateVideoJob field.
 func (r *mutationResolver) UpdateVideoJob(ctx context.Context, jobID string, status string) (string, error) {
-	jobs := r.getJobStatus(jobID)
+	if !database.ValidVideoJobStatus(status) {
+		return "", database.ErrInvalidJobStatus
+	}
+
 	stats, err := database.DB.CreateVideoJob(jobID, status)
 
-	jobs.Observers.Range(func(_, v any) bool {
-		observer := v.(*JobObserver)
+	if err != nil {
+		return stats, err
+	}
 
-		if observer.JobID == jobs.JobID {
-			observer.Status <- stats
-		}
-		return true
-	})
+	r.PublishVideoJob(jobID, stats)
 
-	return stats, err
+	return stats, nil
 }
 
 // FollowUser is the resolver for the followUser field.
 func (r *mutationResolver) FollowUser(ctx context.Context, input model.FollowInput) (*model.Follower, error) {
-	activity := r.getChannelActivity(input.UserID)
-
 	res, err := database.DB.AddFollower(input)
 
 	act, _ := database.DB.CreateActivity(input.FollowerID, input.UserID, "follow", "Followed you")
@@ -219,16 +446,8 @@ func (r *mutationResolver) FollowUser(ctx context.Context, input model.FollowInp
 	act.Sender = sender
 	act.Target = target
 
-	// Notify all active subscriptions that a new message has been posted by posted. In this case we push the now
-	// updated ChatMessages to all clients that care about it.
-	activity.Observers.Range(func(_, v any) bool {
-		observer := v.(*ActivityObserver)
-
-		if observer.ChannelID == activity.ChannelID {
-			observer.Activity <- act
-		}
-		return true
-	})
+	// Notify all active subscriptions that the user has a new follower.
+	r.publish(activityTopic(input.UserID), act)
 
 	return res, err
 }
@@ -245,16 +464,51 @@ func (r *mutationResolver) UpdateChatIdentity(ctx context.Context, userID string
 
 // AddUserInChat is the resolver for the addUserInChat field.
 func (r *mutationResolver) AddUserInChat(ctx context.Context, channelID string, userID string) (bool, error) {
-	return database.DB.AddUserInChat(channelID, userID)
+	if err := database.DB.CheckBan(channelID, userID); err != nil {
+		return false, err
+	}
+
+	joined, err := database.DB.AddUserInChat(channelID, userID)
+
+	if err != nil {
+		return false, err
+	}
+
+	// repeated calls are heartbeats, only a new listing is announced.
+	if !joined {
+		return true, nil
+	}
+
+	if user, err := database.DB.GetUser(userID); err == nil {
+		r.publishChat(channelID, &model.UserJoined{ChannelID: channelID, CreatedAt: time.Now(), User: user})
+	}
+
+	return true, nil
 }
 
 // RemoveUserInChat is the resolver for the removeUserInChat field.
 func (r *mutationResolver) RemoveUserInChat(ctx context.Context, channelID string, userID string) (bool, error) {
-	return database.DB.DeleteUserInChat(channelID, userID)
+	left, err := database.DB.LeaveChat(channelID, userID)
+
+	if err != nil {
+		return false, err
+	}
+
+	// other subscriptions of the user keep them listed.
+	if !left {
+		return true, nil
+	}
+
+	r.publishUserLeft(channelID, userID)
+
+	return true, nil
 }
 
 // CreatePayment is the resolver for the createPayment field.
 func (r *mutationResolver) CreatePayment(ctx context.Context, input model.PaymentInput) (bool, error) {
+	// only the Stripe webhook can mark a payment as paid.
+	input.Status = "pending"
+
 	return database.DB.CreatePayment(input)
 }
 
@@ -270,8 +524,6 @@ func (r *mutationResolver) CreateMembershipDetails(ctx context.Context, input mo
 
 // CreateMembership is the resolver for the createMembership field.
 func (r *mutationResolver) CreateMembership(ctx context.Context, input model.NewMembership) (*model.Membership, error) {
-	activity := r.getChannelActivity(input.ChannelID)
-
 	res, err := database.DB.CreateMembership(input)
 
 	act, _ := database.DB.CreateActivity(input.UserID, input.ChannelID, "subscription", "Subscribed to Tier "+input.Tier)
@@ -282,16 +534,8 @@ func (r *mutationResolver) CreateMembership(ctx context.Context, input model.New
 	act.Sender = sender
 	act.Target = target
 
-	// Notify all active subscriptions that a new message has been posted by posted. In this case we push the now
-	// updated ChatMessages to all clients that care about it.
-	activity.Observers.Range(func(_, v any) bool {
-		observer := v.(*ActivityObserver)
-
-		if observer.ChannelID == activity.ChannelID {
-			observer.Activity <- act
-		}
-		return true
-	})
+	// Notify all active subscriptions that the channel has a new member.
+	r.publish(activityTopic(input.ChannelID), act)
 
 	return res, err
 }
@@ -301,6 +545,25 @@ func (r *mutationResolver) UpdateMembership(ctx context.Context, id string, inpu
 	return database.DB.UpdateMembership(id, input)
 }
 
+// CreateMembershipCheckout is the resolver for the createMembershipCheckout field.
+func (r *mutationResolver) CreateMembershipCheckout(ctx context.Context, channelID string, tier int) (string, error) {
+	tokenData := middlewares.CtxValue(ctx)
+
+	return database.DB.CreateMembershipCheckout(tokenData.ID, channelID, tier)
+}
+
+// GiftMemberships is the resolver for the giftMemberships field.
+func (r *mutationResolver) GiftMemberships(ctx context.Context, channelID string, tier int, count int, recipientIds []string) (string, error) {
+	tokenData := middlewares.CtxValue(ctx)
+
+	return database.DB.CreateGiftCheckout(tokenData.ID, channelID, tier, count, recipientIds)
+}
+
+// CancelMembership is the resolver for the cancelMembership field.
+func (r *mutationResolver) CancelMembership(ctx context.Context, id string) (*model.Membership, error) {
+	return database.DB.CancelMembership(id)
+}
+
 // UpdateMembershipStatus is the resolver for the updateMembershipStatus field.
 func (r *mutationResolver) UpdateMembershipStatus(ctx context.Context, id string, isActive bool) (bool, error) {
 	return database.DB.UpdateMembershipStatus(id, isActive)
@@ -311,14 +574,110 @@ func (r *mutationResolver) DeleteMembership(ctx context.Context, id string) (boo
 	return database.DB.DeleteMembership(id)
 }
 
+// GrantRole is the resolver for the grantRole field.
+func (r *mutationResolver) GrantRole(ctx context.Context, userID string, role model.Role) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	return database.DB.GrantRole(userID, role, "", claim.ID)
+}
+
+// RevokeRole is the resolver for the revokeRole field.
+func (r *mutationResolver) RevokeRole(ctx context.Context, userID string, role model.Role) (bool, error) {
+	return database.DB.RevokeRole(userID, role, "")
+}
+
+// GrantChannelRole is the resolver for the grantChannelRole field.
+func (r *mutationResolver) GrantChannelRole(ctx context.Context, channelID string, userID string, role model.Role) (bool, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	return database.DB.GrantRole(userID, role, channelID, claim.ID)
+}
+
+// RevokeChannelRole is the resolver for the revokeChannelRole field.
+func (r *mutationResolver) RevokeChannelRole(ctx context.Context, channelID string, userID string, role model.Role) (bool, error) {
+	return database.DB.RevokeRole(userID, role, channelID)
+}
+
+// ResolveSupportRequest is the resolver for the resolveSupportRequest field.
+func (r *mutationResolver) ResolveSupportRequest(ctx context.Context, id string, resolved bool) (bool, error) {
+	return database.DB.ResolveSupportRequest(id, resolved)
+}
+
+// SetWaitlistAccess is the resolver for the setWaitlistAccess field.
+func (r *mutationResolver) SetWaitlistAccess(ctx context.Context, id string, canEnter bool) (bool, error) {
+	return database.DB.SetWaitlistAccess(id, canEnter)
+}
+
 // AddFlakes is the resolver for the addFlakes field.
-func (r *mutationResolver) AddFlakes(ctx context.Context, userID string, amount int) (bool, error) {
-	return database.DB.AddFlakes(userID, amount)
+func (r *mutationResolver) AddFlakes(ctx context.Context, userID string, amount int, idempotencyKey *string) (bool, error) {
+	return database.DB.AddFlakes(userID, amount, stringValue(idempotencyKey))
+}
+
+// CreateFlakesCheckout is the resolver for the createFlakesCheckout field.
+func (r *mutationResolver) CreateFlakesCheckout(ctx context.Context, packID string) (string, error) {
+	tokenData := middlewares.CtxValue(ctx)
+
+	return database.DB.CreateFlakesCheckout(tokenData.ID, packID)
+}
+
+// CreateFlakesDrop is the resolver for the createFlakesDrop field.
+func (r *mutationResolver) CreateFlakesDrop(ctx context.Context, channelID string, input model.FlakesDropInput) (*model.FlakesDrop, error) {
+	drop, msg, err := database.DB.CreateFlakesDrop(channelID, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.publishChat(channelID, &model.MessageCreated{ChannelID: channelID, CreatedAt: msg.CreatedAt, Message: msg})
+
+	return drop, nil
+}
+
+// ClaimFlakesDrop is the resolver for the claimFlakesDrop field.
+func (r *mutationResolver) ClaimFlakesDrop(ctx context.Context, channelID string, code string) (int, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	if err := database.DB.CheckBan(channelID, claim.ID); err != nil {
+		return 0, err
+	}
+
+	drop, err := database.DB.ClaimFlakesDrop(channelID, claim.ID, code)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if user, err := database.DB.GetUser(claim.ID); err == nil {
+		r.publishSystemMessage(channelID, claim.ID, "drop_claim", fmt.Sprintf("%s claimed %d Flakes", user.Username, drop.PerClaim), drop.PerClaim)
+	}
+
+	return drop.PerClaim, nil
+}
+
+// CreatePayoutOnboardingLink is the resolver for the createPayoutOnboardingLink field.
+func (r *mutationResolver) CreatePayoutOnboardingLink(ctx context.Context, channelID string) (string, error) {
+	return database.DB.CreatePayoutOnboardingLink(channelID)
+}
+
+// RequestPayout is the resolver for the requestPayout field.
+func (r *mutationResolver) RequestPayout(ctx context.Context, channelID string) (*model.Payout, error) {
+	return database.DB.RequestPayout(channelID)
 }
 
 // CreatePost is the resolver for the createPost field.
 func (r *mutationResolver) CreatePost(ctx context.Context, input model.NewPostInput) (bool, error) {
-	return database.DB.CreatePost(input)
+	post, err := database.DB.CreatePost(input)
+
+	if err != nil || post == nil {
+		return false, err
+	}
+
+	// Only top level posts are pushed live, replies are fetched with their thread.
+	if post.ReplyTo == "" {
+		go r.publishPost(post)
+	}
+
+	return true, nil
 }
 
 // DeletePost is the resolver for the deletePost field.
@@ -366,24 +725,29 @@ func (r *queryResolver) SearchUsers(ctx context.Context, query string) ([]*model
 	return database.DB.SearchUsers(query)
 }
 
+// GetUserDetails is the resolver for the getUserDetails field.
+func (r *queryResolver) GetUserDetails(ctx context.Context, id string) (*model.UserDetails, error) {
+	return database.DB.GetUserDetails(id)
+}
+
 // GetVideos is the resolver for the getVideos field.
 func (r *queryResolver) GetVideos(ctx context.Context, channelID string, first int, after string) (*model.VideosResult, error) {
-	return database.DB.GetVideos(channelID, first, after)
+	return database.DB.GetVideos(viewerID(ctx), channelID, first, after)
 }
 
 // GetAllVideos is the resolver for the getAllVideos field.
 func (r *queryResolver) GetAllVideos(ctx context.Context, first int, after string) (*model.VideosResult, error) {
-	return database.DB.GetAllVideos(first, after)
+	return database.DB.GetAllVideos(viewerID(ctx), first, after)
 }
 
 // GetVideosByCategory is the resolver for the getVideosByCategory field.
 func (r *queryResolver) GetVideosByCategory(ctx context.Context, category string, first int, after string) (*model.VideosResult, error) {
-	return database.DB.GetVideosByCategory(category, first, after)
+	return database.DB.GetVideosByCategory(viewerID(ctx), category, first, after)
 }
 
 // GetVideoByID is the resolver for the getVideoById field.
 func (r *queryResolver) GetVideoByID(ctx context.Context, id string) (*model.Video, error) {
-	return database.DB.GetVideoByID(id)
+	return database.DB.GetVideoForViewer(viewerID(ctx), id)
 }
 
 // GetVideoViews is the resolver for the getVideoViews field.
@@ -406,9 +770,20 @@ func (r *queryResolver) GetVideoJob(ctx context.Context, jobID string) (string,
 	return database.DB.GetVideoJob(jobID)
 }
 
+// GetPlaybackToken is the resolver for the getPlaybackToken field.
+func (r *queryResolver) GetPlaybackToken(ctx context.Context, videoID *string, channelID *string) (*model.PlaybackToken, error) {
+	playbackID, policy, err := database.DB.PlaybackFor(viewerID(ctx), stringValue(videoID), stringValue(channelID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.playbackToken(playbackID, policy)
+}
+
 // SearchVideos is the resolver for the searchVideos field.
 func (r *queryResolver) SearchVideos(ctx context.Context, query string, first int, after string) (*model.VideosResult, error) {
-	return database.DB.SearchVideos(query, first, after)
+	return database.DB.SearchVideos(viewerID(ctx), query, first, after)
 }
 
 // GetFollowers is the resolver for the getFollowers field.
@@ -441,11 +816,36 @@ func (r *queryResolver) GetRecentMessages(ctx context.Context, channelID string)
 	return database.DB.GetRecentMessages(channelID)
 }
 
+// GetMessages is the resolver for the getMessages field.
+func (r *queryResolver) GetMessages(ctx context.Context, channelID string, before *string, first int) (*model.MessagesResult, error) {
+	return database.DB.GetMessages(channelID, stringValue(before), first)
+}
+
+// GetMessageReplies is the resolver for the getMessageReplies field.
+func (r *queryResolver) GetMessageReplies(ctx context.Context, messageID string, before *string, first int) (*model.MessagesResult, error) {
+	return database.DB.GetMessageReplies(messageID, stringValue(before), first)
+}
+
+// GetPinnedMessages is the resolver for the getPinnedMessages field.
+func (r *queryResolver) GetPinnedMessages(ctx context.Context, channelID string) ([]*model.Message, error) {
+	return database.DB.GetPinnedMessages(channelID)
+}
+
+// SearchMessages is the resolver for the searchMessages field.
+func (r *queryResolver) SearchMessages(ctx context.Context, channelID string, filter model.MessageSearchInput, before *string, first int) (*model.MessagesResult, error) {
+	return database.DB.SearchMessages(channelID, filter, stringValue(before), first)
+}
+
 // GetChatIdentity is the resolver for the getChatIdentity field.
 func (r *queryResolver) GetChatIdentity(ctx context.Context, userID string) (*model.ChatIdentity, error) {
 	return database.DB.GetChatIdentity(userID)
 }
 
+// GetChatSettings is the resolver for the getChatSettings field.
+func (r *queryResolver) GetChatSettings(ctx context.Context, channelID string) (*model.ChatSettings, error) {
+	return database.DB.GetChatSettings(channelID)
+}
+
 // GetUsersInChat is the resolver for the getUsersInChat field.
 func (r *queryResolver) GetUsersInChat(ctx context.Context, channelID string) ([]*model.User, error) {
 	return database.DB.GetUsersInChat(channelID)
@@ -456,6 +856,11 @@ func (r *queryResolver) GetRecentActivity(ctx context.Context, channelID string)
 	return database.DB.GetRecentActivity(channelID)
 }
 
+// GetChannelBans is the resolver for the getChannelBans field.
+func (r *queryResolver) GetChannelBans(ctx context.Context, channelID string) ([]*model.ChannelBan, error) {
+	return database.DB.GetChannelBans(channelID)
+}
+
 // GetPaymentBySession is the resolver for the getPaymentBySession field.
 func (r *queryResolver) GetPaymentBySession(ctx context.Context, sessionID string) (*model.Payment, error) {
 	return database.DB.GetPaymentBySession(sessionID)
@@ -486,11 +891,63 @@ func (r *queryResolver) GetChannelInfo(ctx context.Context, userID string) (*mod
 	return database.DB.GetChannelInfo(userID)
 }
 
+// ListSessions is the resolver for the listSessions field.
+func (r *queryResolver) ListSessions(ctx context.Context) ([]*model.Session, error) {
+	claim := middlewares.CtxValue(ctx)
+
+	return database.DB.ListSessions(claim.ID, claim.SessionID)
+}
+
+// GetUserRoles is the resolver for the getUserRoles field.
+func (r *queryResolver) GetUserRoles(ctx context.Context, userID string) ([]*model.UserRole, error) {
+	return database.DB.GetUserRoles(userID)
+}
+
+// GetChannelRoles is the resolver for the getChannelRoles field.
+func (r *queryResolver) GetChannelRoles(ctx context.Context, channelID string) ([]*model.UserRole, error) {
+	return database.DB.GetChannelRoles(channelID)
+}
+
+// GetSupportRequests is the resolver for the getSupportRequests field.
+func (r *queryResolver) GetSupportRequests(ctx context.Context, resolved bool) ([]*model.SupportRequest, error) {
+	return database.DB.GetSupportRequests(resolved)
+}
+
+// GetWaitlist is the resolver for the getWaitlist field.
+func (r *queryResolver) GetWaitlist(ctx context.Context, canEnter bool, first int) ([]*model.Waitlist, error) {
+	return database.DB.GetWaitlist(canEnter, first)
+}
+
+// GetLogs is the resolver for the getLogs field.
+func (r *queryResolver) GetLogs(ctx context.Context, first int) ([]*model.Logs, error) {
+	return database.DB.GetLogs(first)
+}
+
 // GetFlakes is the resolver for the getFlakes field.
 func (r *queryResolver) GetFlakes(ctx context.Context, userID string) (int, error) {
 	return database.DB.GetFlakes(userID)
 }
 
+// GetFlakesPacks is the resolver for the getFlakesPacks field.
+func (r *queryResolver) GetFlakesPacks(ctx context.Context) ([]*model.FlakesPack, error) {
+	return database.DB.GetFlakesPacks()
+}
+
+// GetPayoutBalance is the resolver for the getPayoutBalance field.
+func (r *queryResolver) GetPayoutBalance(ctx context.Context, channelID string) (*model.PayoutBalance, error) {
+	return database.DB.GetPayoutBalance(channelID)
+}
+
+// GetPayouts is the resolver for the getPayouts field.
+func (r *queryResolver) GetPayouts(ctx context.Context, channelID string) ([]*model.Payout, error) {
+	return database.DB.GetPayouts(channelID)
+}
+
+// GetFlakesLedger is the resolver for the getFlakesLedger field.
+func (r *queryResolver) GetFlakesLedger(ctx context.Context, userID string, first int) ([]*model.FlakesLedgerEntry, error) {
+	return database.DB.GetFlakesLedger(userID, first)
+}
+
 // GetChannelFlakes is the resolver for the getChannelFlakes field.
 func (r *queryResolver) GetChannelFlakes(ctx context.Context, channelID string) ([]*model.ChannelFlakes, error) {
 	return database.DB.GetChannelFlakes(channelID)
@@ -501,6 +958,11 @@ func (r *queryResolver) GetChannelFlakesLeaders(ctx context.Context, channelID s
 	return database.DB.GetChannelFlakesLeaders(channelID)
 }
 
+// GetActiveFlakesDrops is the resolver for the getActiveFlakesDrops field.
+func (r *queryResolver) GetActiveFlakesDrops(ctx context.Context, channelID string) ([]*model.FlakesDrop, error) {
+	return database.DB.GetActiveFlakesDrops(channelID)
+}
+
 // GetUserPosts is the resolver for the getUserPosts field.
 func (r *queryResolver) GetUserPosts(ctx context.Context, channelID string, first int, after string) (*model.PostsResult, error) {
 	return database.DB.GetUserPosts(channelID, first, after)
@@ -548,124 +1010,96 @@ func (r *queryResolver) GetLikedByUser(ctx context.Context, postID string, userI
 
 // GetMessages is the resolver for the getMessages field.
 func (r *subscriptionResolver) GetMessages(ctx context.Context, channelID string, userID string) (<-chan *model.Message, error) {
-	room := r.getRoom(channelID)
-
-	id := randString(8)
-	events := make(chan *model.Message, 1)
+	// kept for older clients, only the events that used to be messages are
+	// passed on.
+	events, err := subscribeChat(ctx, r.Broker, channelID, func(event chatEvent) (*model.Message, bool) {
+		msg := event.message()
+		return msg, msg != nil
+	})
 
-	database.DB.AddUserInChat(channelID, userID)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("getting messages: ", channelID, userID)
+	r.joinChat(ctx, channelID, userID)
 
-	go func() {
-		<-ctx.Done()
-		room.Observers.Delete(id)
-		database.DB.DeleteUserInChat(channelID, userID)
-	}()
+	return events, nil
+}
 
-	room.Observers.Store(id, &Observer{
-		ChannelID: channelID,
-		Message:   events,
+// GetChatEvents is the resolver for the getChatEvents field.
+func (r *subscriptionResolver) GetChatEvents(ctx context.Context, channelID string) (<-chan model.ChatEvent, error) {
+	events, err := subscribeChat(ctx, r.Broker, channelID, func(event chatEvent) (model.ChatEvent, bool) {
+		chatEvent := event.event()
+		return chatEvent, chatEvent != nil
 	})
 
+	if err != nil {
+		return nil, err
+	}
+
+	r.joinChat(ctx, channelID, viewerID(ctx))
+
 	return events, nil
 }
 
 // GetVideoViewers is the resolver for the getVideoViewers field.
 func (r *subscriptionResolver) GetVideoViewers(ctx context.Context, videoID string) (<-chan int, error) {
-	viewer := r.getVideoViewers(videoID)
-
-	id := randString(8)
-	events := make(chan int, 1)
-
-	go func() {
-		<-ctx.Done()
-		viewer.Observers.Delete(id)
-	}()
-
-	viewer.Observers.Store(id, &VideoObserver{
-		VideoID: videoID,
-		Count:   events,
-	})
-
-	return events, nil
+	return subscribe[int](ctx, r.Broker, videoViewersTopic(videoID))
 }
 
 // GetChannelViewers is the resolver for the getChannelViewers field.
 func (r *subscriptionResolver) GetChannelViewers(ctx context.Context, channelID string, userID string) (<-chan int, error) {
-	viewer := r.getChannelViewers(channelID)
-
-	id := randString(8)
-	events := make(chan int, 1)
+	events, err := subscribe[int](ctx, r.Broker, channelViewersTopic(channelID))
 
-	fmt.Println("Live Viewer Detected")
+	if err != nil {
+		return nil, err
+	}
 
-	go func() {
-		<-ctx.Done()
-		viewer.Observers.Delete(id)
-		database.DB.DeleteChannelView(channelID, userID)
-		// TODO: Remove delete channel viewer endpoint since this takes care of it.
-		fmt.Println("Removed Channel Viewer")
-	}()
+	if userID != "" {
+		if joined, _ := database.DB.JoinChannelViewers(channelID, userID); joined {
+			r.publishChannelViewers(channelID)
+		}
 
-	viewer.Observers.Store(id, &ChannelObserver{
-		ChannelID: channelID,
-		Count:     events,
-	})
+		heartbeat(ctx, func() {
+			database.DB.TouchChannelViewer(channelID, userID)
+		}, func() {
+			if left, _ := database.DB.LeaveChannelViewers(channelID, userID); left {
+				r.publishChannelViewers(channelID)
+			}
+		})
+	}
 
 	return events, nil
 }
 
 // GetActivity is the resolver for the getActivity field.
 func (r *subscriptionResolver) GetActivity(ctx context.Context, channelID string) (<-chan *model.Activity, error) {
-	activity := r.getChannelActivity(channelID)
-
-	id := randString(8)
-	events := make(chan *model.Activity, 1)
-
-	go func() {
-		<-ctx.Done()
-		activity.Observers.Delete(id)
-	}()
-
-	activity.Observers.Store(id, &ActivityObserver{
-		ChannelID: channelID,
-		Activity:  events,
-	})
-
-	return events, nil
+	return subscribe[*model.Activity](ctx, r.Broker, activityTopic(channelID))
 }
 
 // GetVideoJob is the resolver for the getVideoJob field.
 func (r *subscriptionResolver) GetVideoJob(ctx context.Context, jobID string) (<-chan string, error) {
-	room := r.getJobStatus(jobID)
-
-	id := randString(8)
-	events := make(chan string, 1)
-
-	go func() {
-		<-ctx.Done()
-		room.Observers.Delete(id)
-	}()
-
-	room.Observers.Store(id, &JobObserver{
-		JobID:  jobID,
-		Status: events,
-	})
-
-	return events, nil
+	return subscribe[string](ctx, r.Broker, jobTopic(jobID))
 }
 
 // GetFeedPosts is the resolver for the getFeedPosts field.
 func (r *subscriptionResolver) GetFeedPosts(ctx context.Context) (<-chan *model.Post, error) {
-	panic(fmt.Errorf("not implemented: GetFeedPosts - getFeedPosts"))
+	claim := middlewares.CtxValue(ctx)
+
+	return subscribe[*model.Post](ctx, r.Broker, feedTopic(claim.ID))
 }
 
 // GetProfilePosts is the resolver for the getProfilePosts field.
-func (r *subscriptionResolver) GetProfilePosts(ctx context.Context) (<-chan *model.Post, error) {
-	panic(fmt.Errorf("not implemented: GetProfilePosts - getProfilePosts"))
+func (r *subscriptionResolver) GetProfilePosts(ctx context.Context, userID string) (<-chan *model.Post, error) {
+	return subscribe[*model.Post](ctx, r.Broker, profileTopic(userID))
 }
 
+// Channel returns ChannelResolver implementation.
+func (r *Resolver) Channel() ChannelResolver { return &channelResolver{r} }
+
+// Message returns MessageResolver implementation.
+func (r *Resolver) Message() MessageResolver { return &messageResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -675,6 +1109,8 @@ func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+type channelResolver struct{ *Resolver }
+type messageResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
@@ -3,8 +3,11 @@ package middlewares
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/glitchd/glitchd-server/database"
 )
 
@@ -14,6 +17,35 @@ type ErrorPayload struct {
 	Message string
 }
 
+var errInvalidToken = errors.New("Invalid token")
+
+// authenticate validates an access token and makes sure the session it was
+// issued for has not been revoked.
+func authenticate(token string) (*database.CustomClaim, error) {
+	validate, err := database.JwtValidate(context.Background(), token)
+	if err != nil || !validate.Valid {
+		return nil, errInvalidToken
+	}
+
+	customClaim, ok := validate.Claims.(*database.CustomClaim)
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	// tokens issued before sessions existed carry no session and stay valid
+	// until they expire, revoking sessions does not reach them.
+	if customClaim.SessionID == "" {
+		return customClaim, nil
+	}
+
+	active, err := database.DB.IsSessionActive(customClaim.SessionID)
+	if err != nil || !active {
+		return nil, errInvalidToken
+	}
+
+	return customClaim, nil
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
@@ -26,8 +58,8 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		bearer := "Bearer "
 		auth = auth[len(bearer):]
 
-		validate, err := database.JwtValidate(context.Background(), auth)
-		if err != nil || !validate.Valid {
+		customClaim, err := authenticate(auth)
+		if err != nil {
 			p := ErrorPayload{
 				Message: "Invalid token",
 			}
@@ -35,7 +67,6 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		customClaim, _ := validate.Claims.(*database.CustomClaim)
 		ctx := context.WithValue(r.Context(), authString("auth"), customClaim)
 
 		r = r.WithContext(ctx)
@@ -43,6 +74,23 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// WebsocketInit authenticates subscriptions from the connection_init payload,
+// since browsers cannot set headers on websocket upgrades.
+func WebsocketInit(ctx context.Context, initPayload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+	auth := initPayload.Authorization()
+
+	if auth == "" || CtxValue(ctx) != nil {
+		return ctx, nil, nil
+	}
+
+	customClaim, err := authenticate(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context.WithValue(ctx, authString("auth"), customClaim), nil, nil
+}
+
 func CtxValue(ctx context.Context) *database.CustomClaim {
 	raw, _ := ctx.Value(authString("auth")).(*database.CustomClaim)
 	return raw
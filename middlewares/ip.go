@@ -0,0 +1,115 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type ipString string
+
+var (
+	trustedOnce sync.Once
+	trusted     []*net.IPNet
+)
+
+// trustedProxies parses TRUSTED_PROXIES, a comma separated list of addresses
+// or CIDR ranges of the load balancers in front of the API.
+func trustedProxies() []*net.IPNet {
+	trustedOnce.Do(func() {
+		trusted = parseProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+
+	return trusted
+}
+
+func parseProxies(list string) []*net.IPNet {
+	var nets []*net.IPNet
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+		}
+	}
+
+	return nets
+}
+
+func isTrusted(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, n := range proxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the address of the caller. X-Forwarded-For is only read when
+// the request came from a trusted proxy, and then from the right since the
+// entries on the left are whatever the client sent.
+func clientIP(remoteAddr string, forwarded string, proxies []*net.IPNet) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if forwarded == "" || !isTrusted(ip, proxies) {
+		return ip
+	}
+
+	hops := strings.Split(forwarded, ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+
+		if !isTrusted(hop, proxies) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// ClientIPMiddleware stores the caller's address on the request context.
+// Behind a load balancer TRUSTED_PROXIES has to list it, otherwise every
+// request appears to come from the balancer.
+func ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r.RemoteAddr, strings.Join(r.Header.Values("X-Forwarded-For"), ","), trustedProxies())
+
+		ctx := context.WithValue(r.Context(), ipString("ip"), ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func IPValue(ctx context.Context) string {
+	raw, _ := ctx.Value(ipString("ip")).(string)
+	return raw
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import "testing"
+
+func TestClientIP(t *testing.T) {
+	proxies := parseProxies("10.0.0.0/8, 192.168.1.5")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5123", "", "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:5123", "198.51.100.1", "203.0.113.7"},
+		{"behind trusted proxy", "10.1.2.3:443", "198.51.100.1", "198.51.100.1"},
+		{"client prepends fake hops", "10.1.2.3:443", "1.2.3.4, 5.6.7.8, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:443", "198.51.100.1, 192.168.1.5, 10.9.9.9", "198.51.100.1"},
+		{"garbage hop stops the walk", "10.1.2.3:443", "198.51.100.1, not-an-ip", "10.1.2.3"},
+		{"only proxies", "10.1.2.3:443", "10.4.4.4", "10.4.4.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIP(tt.remoteAddr, tt.forwarded, proxies); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    device TEXT NOT NULL DEFAULT '',
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    previous_refresh_token_hash TEXT,
+    expires_at timestamp NOT NULL,
+    revoked_at timestamp,
+    last_used_at timestamp NOT NULL DEFAULT NOW(),
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
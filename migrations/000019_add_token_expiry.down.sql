@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS login_attempts;
+DROP INDEX IF EXISTS tokens_user_id_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS expires_at;
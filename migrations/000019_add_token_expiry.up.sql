@@ -0,0 +1,13 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS expires_at timestamp NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id UUID NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_user_id_idx ON login_attempts (user_id, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_address_idx ON login_attempts (ip_address, created_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+    id UUID NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    channel_id TEXT NOT NULL DEFAULT '',
+    granted_by TEXT NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, role, channel_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_channel_id_idx ON user_roles (channel_id);
@@ -0,0 +1,4 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE messages DROP COLUMN IF EXISTS is_deleted;
+DROP TABLE IF EXISTS channel_bans;
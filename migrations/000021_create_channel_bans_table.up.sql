@@ -0,0 +1,15 @@
+-- expires_at is NULL for permanent bans and set for timeouts.
+CREATE TABLE IF NOT EXISTS channel_bans (
+    id UUID NOT NULL PRIMARY KEY,
+    channel_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    moderator_id TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at timestamp,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    UNIQUE (channel_id, user_id)
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at timestamp;
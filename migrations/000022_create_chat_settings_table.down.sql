@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_channel_sender_idx;
+DROP TABLE IF EXISTS chat_settings;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS chat_settings (
+    channel_id TEXT NOT NULL PRIMARY KEY,
+    slow_mode_seconds INTEGER NOT NULL DEFAULT 0,
+    follower_only BOOLEAN NOT NULL DEFAULT false,
+    follower_min_minutes INTEGER NOT NULL DEFAULT 0,
+    member_only BOOLEAN NOT NULL DEFAULT false,
+    emote_only BOOLEAN NOT NULL DEFAULT false,
+    updated_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS messages_channel_sender_idx ON messages (channel_id, sender_id, created_at);
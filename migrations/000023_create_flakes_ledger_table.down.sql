@@ -0,0 +1,2 @@
+ALTER TABLE flakes DROP CONSTRAINT IF EXISTS flakes_amount_non_negative;
+DROP TABLE IF EXISTS flakes_ledger;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS flakes_ledger (
+    id UUID NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    delta INTEGER NOT NULL,
+    balance INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    reference_id TEXT NOT NULL DEFAULT '',
+    idempotency_key TEXT,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS flakes_ledger_idempotency_idx ON flakes_ledger (user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS flakes_ledger_user_idx ON flakes_ledger (user_id, created_at DESC);
+
+-- balances that went negative through racing tips are reset before the check is added.
+UPDATE flakes SET amount = 0 WHERE amount < 0;
+ALTER TABLE flakes ADD CONSTRAINT flakes_amount_non_negative CHECK (amount >= 0);
+
+-- open the ledger with the current balances so it adds up to the flakes table.
+INSERT INTO flakes_ledger (id, user_id, delta, balance, kind)
+SELECT gen_random_uuid(), user_id, amount, amount, 'opening' FROM flakes WHERE amount > 0;
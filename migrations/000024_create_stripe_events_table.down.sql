@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS memberships_subscription_idx;
+ALTER TABLE memberships DROP COLUMN IF EXISTS stripe_subscription_id;
+
+DROP INDEX IF EXISTS payments_payment_intent_idx;
+DROP INDEX IF EXISTS payments_session_idx;
+ALTER TABLE payments DROP COLUMN IF EXISTS flakes;
+ALTER TABLE payments DROP COLUMN IF EXISTS kind;
+ALTER TABLE payments DROP COLUMN IF EXISTS payment_intent_id;
+ALTER TABLE payments DROP COLUMN IF EXISTS session_id;
+
+DROP TABLE IF EXISTS stripe_events;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS stripe_events (
+    id TEXT NOT NULL PRIMARY KEY,
+    type TEXT NOT NULL,
+    processed_at timestamp NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS session_id TEXT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS payment_intent_id TEXT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS flakes INTEGER NOT NULL DEFAULT 0;
+
+-- payments were created with the checkout session id as their order id.
+UPDATE payments SET session_id = order_id WHERE session_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS payments_session_idx ON payments (session_id);
+CREATE INDEX IF NOT EXISTS payments_payment_intent_idx ON payments (payment_intent_id);
+
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS stripe_subscription_id TEXT;
+
+CREATE INDEX IF NOT EXISTS memberships_subscription_idx ON memberships (stripe_subscription_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS flakes_packs (
+    id UUID NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL,
+    flakes INTEGER NOT NULL CHECK (flakes > 0),
+    price_cents INTEGER NOT NULL CHECK (price_cents > 0),
+    currency TEXT NOT NULL DEFAULT 'usd',
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO flakes_packs (id, name, flakes, price_cents) VALUES
+    (gen_random_uuid(), 'Handful of Flakes', 100, 140),
+    (gen_random_uuid(), 'Bag of Flakes', 500, 700),
+    (gen_random_uuid(), 'Bucket of Flakes', 1500, 1995),
+    (gen_random_uuid(), 'Blizzard of Flakes', 5000, 6440);
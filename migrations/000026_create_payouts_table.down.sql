@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS channel_flakes_channel_idx;
+DROP TABLE IF EXISTS payouts;
+ALTER TABLE users DROP COLUMN IF EXISTS stripe_account_id;
@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS stripe_account_id TEXT;
+
+CREATE TABLE IF NOT EXISTS payouts (
+    id UUID NOT NULL PRIMARY KEY,
+    channel_id TEXT NOT NULL,
+    flakes INTEGER NOT NULL,
+    gross_cents INTEGER NOT NULL,
+    fee_cents INTEGER NOT NULL,
+    amount_cents INTEGER NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'usd',
+    status TEXT NOT NULL DEFAULT 'pending',
+    stripe_transfer_id TEXT,
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payouts_channel_idx ON payouts (channel_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS channel_flakes_channel_idx ON channel_flakes (channel_id);
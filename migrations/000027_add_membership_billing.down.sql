@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS memberships_user_channel_idx;
+
+ALTER TABLE memberships DROP COLUMN IF EXISTS cancel_at_period_end;
+ALTER TABLE memberships DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE memberships DROP COLUMN IF EXISTS status;
+
+ALTER TABLE membership_details DROP COLUMN IF EXISTS stripe_price_id;
+ALTER TABLE membership_details DROP COLUMN IF EXISTS stripe_product_id;
+ALTER TABLE membership_details DROP COLUMN IF EXISTS currency;
+ALTER TABLE membership_details DROP COLUMN IF EXISTS price_cents;
@@ -0,0 +1,14 @@
+ALTER TABLE membership_details ADD COLUMN IF NOT EXISTS price_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE membership_details ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'usd';
+ALTER TABLE membership_details ADD COLUMN IF NOT EXISTS stripe_product_id TEXT;
+ALTER TABLE membership_details ADD COLUMN IF NOT EXISTS stripe_price_id TEXT;
+
+UPDATE membership_details SET price_cents = ROUND(cost::numeric * 100) WHERE cost ~ '^[0-9]+(\.[0-9]{1,2})?$';
+
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS expires_at timestamp;
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE memberships SET status = 'cancelled' WHERE is_active = false;
+
+CREATE INDEX IF NOT EXISTS memberships_user_channel_idx ON memberships (user_id, channel_id);
@@ -0,0 +1,2 @@
+ALTER TABLE memberships DROP COLUMN IF EXISTS gift_id;
+DROP TABLE IF EXISTS membership_gifts;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS membership_gifts (
+    id UUID NOT NULL PRIMARY KEY,
+    gifter_id TEXT NOT NULL,
+    channel_id TEXT NOT NULL,
+    tier TEXT NOT NULL,
+    count INTEGER NOT NULL CHECK (count > 0),
+    requested_ids TEXT[] NOT NULL DEFAULT '{}',
+    session_id TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    fulfilled_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS membership_gifts_channel_idx ON membership_gifts (channel_id, created_at DESC);
+
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS gift_id UUID;
@@ -0,0 +1,5 @@
+ALTER TABLE videos DROP COLUMN IF EXISTS playback_policy;
+ALTER TABLE videos DROP COLUMN IF EXISTS playback_id;
+ALTER TABLE videos DROP COLUMN IF EXISTS asset_id;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS playback_policy;
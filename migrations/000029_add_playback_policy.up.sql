@@ -0,0 +1,5 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS playback_policy TEXT NOT NULL DEFAULT 'PUBLIC';
+
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS asset_id TEXT;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS playback_id TEXT;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS playback_policy TEXT NOT NULL DEFAULT 'PUBLIC';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS videos_asset_idx;
+DROP INDEX IF EXISTS channels_livestream_idx;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS went_live_at;
+ALTER TABLE channels DROP COLUMN IF EXISTS is_live;
+
+DROP TABLE IF EXISTS mux_events;
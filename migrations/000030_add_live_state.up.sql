@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS mux_events (
+    id TEXT NOT NULL PRIMARY KEY,
+    type TEXT NOT NULL,
+    processed_at timestamp NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS is_live BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS went_live_at timestamp;
+
+CREATE INDEX IF NOT EXISTS channels_livestream_idx ON channels (livestream_id);
+
+-- one video per Mux asset, recordings are created from webhook retries too.
+CREATE UNIQUE INDEX IF NOT EXISTS videos_asset_idx ON videos (asset_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS followers_user_follower_idx;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS live_notified_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS live_email_notifications;
+ALTER TABLE users DROP COLUMN IF EXISTS mobile_push_token;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mobile_push_token TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS live_email_notifications BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS live_notified_at timestamp;
+
+CREATE INDEX IF NOT EXISTS followers_user_follower_idx ON followers (user_id, follower_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_search_idx;
+DROP INDEX IF EXISTS messages_channel_created_idx;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS messages_channel_created_idx ON messages (channel_id, created_at DESC, id DESC);
+
+-- backs searchMessages, queries must use the same to_tsvector expression.
+CREATE INDEX IF NOT EXISTS messages_search_idx ON messages USING GIN (to_tsvector('simple', message));
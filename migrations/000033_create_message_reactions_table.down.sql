@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS messages_pinned_idx;
+DROP INDEX IF EXISTS messages_reply_parent_idx;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned_by;
+ALTER TABLE messages DROP COLUMN IF EXISTS is_pinned;
+
+DROP TABLE IF EXISTS message_reactions;
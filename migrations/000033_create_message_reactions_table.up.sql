@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id UUID NOT NULL,
+    user_id TEXT NOT NULL,
+    emoji TEXT NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS is_pinned BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS pinned_by TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS pinned_at timestamp;
+
+CREATE INDEX IF NOT EXISTS messages_reply_parent_idx ON messages (reply_parent_message_id) WHERE reply_parent_message_id <> '';
+CREATE INDEX IF NOT EXISTS messages_pinned_idx ON messages (channel_id) WHERE is_pinned = true;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS flakes_drop_claims;
+DROP TABLE IF EXISTS flakes_drops;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS flakes_drops (
+    id UUID NOT NULL PRIMARY KEY,
+    channel_id TEXT NOT NULL,
+    message_id TEXT NOT NULL DEFAULT '',
+    code TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    pool INTEGER NOT NULL CHECK (pool > 0),
+    per_claim INTEGER NOT NULL CHECK (per_claim > 0),
+    max_claims INTEGER NOT NULL CHECK (max_claims > 0),
+    claims INTEGER NOT NULL DEFAULT 0,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS flakes_drops_channel_idx ON flakes_drops (channel_id, expires_at DESC);
+
+CREATE TABLE IF NOT EXISTS flakes_drop_claims (
+    drop_id UUID NOT NULL,
+    user_id TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (drop_id, user_id)
+);
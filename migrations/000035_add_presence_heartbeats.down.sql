@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS channel_viewers_last_seen_idx;
+DROP INDEX IF EXISTS chat_users_last_seen_idx;
+DROP INDEX IF EXISTS channel_viewers_channel_user_idx;
+DROP INDEX IF EXISTS chat_users_channel_user_idx;
+
+ALTER TABLE channel_viewers DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE chat_users DROP COLUMN IF EXISTS last_seen_at;
@@ -0,0 +1,13 @@
+ALTER TABLE chat_users ADD COLUMN IF NOT EXISTS last_seen_at timestamp NOT NULL DEFAULT NOW();
+ALTER TABLE channel_viewers ADD COLUMN IF NOT EXISTS last_seen_at timestamp NOT NULL DEFAULT NOW();
+
+-- one row per viewer, heartbeats refresh it instead of adding more.
+DELETE FROM chat_users a USING chat_users b
+    WHERE a.channel_id = b.channel_id AND a.user_id = b.user_id AND a.ctid < b.ctid;
+DELETE FROM channel_viewers a USING channel_viewers b
+    WHERE a.channel_id = b.channel_id AND a.user_id = b.user_id AND a.ctid < b.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS chat_users_channel_user_idx ON chat_users (channel_id, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS channel_viewers_channel_user_idx ON channel_viewers (channel_id, user_id);
+CREATE INDEX IF NOT EXISTS chat_users_last_seen_idx ON chat_users (last_seen_at);
+CREATE INDEX IF NOT EXISTS channel_viewers_last_seen_idx ON channel_viewers (last_seen_at);
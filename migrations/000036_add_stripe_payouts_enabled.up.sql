@@ -0,0 +1,4 @@
+-- only the account.updated webhook writes this. stripe_connected_link could be
+-- set by clients, so it is not copied over, Stripe sends account.updated again
+-- whenever the account changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS stripe_payouts_enabled BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE membership_gifts DROP COLUMN IF EXISTS unassigned;
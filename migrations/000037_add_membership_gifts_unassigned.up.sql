@@ -0,0 +1,3 @@
+-- memberships of a gift nobody in chat could receive, left for support to
+-- refund or hand out.
+ALTER TABLE membership_gifts ADD COLUMN IF NOT EXISTS unassigned INTEGER NOT NULL DEFAULT 0;
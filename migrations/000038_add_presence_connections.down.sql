@@ -0,0 +1,2 @@
+ALTER TABLE channel_viewers DROP COLUMN IF EXISTS connections;
+ALTER TABLE chat_users DROP COLUMN IF EXISTS connections;
@@ -0,0 +1,4 @@
+-- open subscriptions behind a presence row, it is only removed when the last
+-- one closes. Rows of a crashed server still expire through last_seen_at.
+ALTER TABLE chat_users ADD COLUMN IF NOT EXISTS connections INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE channel_viewers ADD COLUMN IF NOT EXISTS connections INTEGER NOT NULL DEFAULT 1;
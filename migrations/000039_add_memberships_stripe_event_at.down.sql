@@ -0,0 +1 @@
+ALTER TABLE memberships DROP COLUMN IF EXISTS stripe_event_at;
@@ -0,0 +1,3 @@
+-- created time of the last Stripe event applied to a subscription membership,
+-- older events that arrive late are skipped.
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS stripe_event_at TIMESTAMP;
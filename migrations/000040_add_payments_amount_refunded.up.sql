@@ -0,0 +1,2 @@
+-- cents refunded so far, Stripe reports the running total with every refund.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS amount_refunded BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,201 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/glitchd/glitchd-server/graph/model"
+)
+
+const (
+	// DefaultCooldown keeps a flaky connection that drops and comes back from
+	// notifying followers over and over.
+	DefaultCooldown = 30 * time.Minute
+
+	followersPage = 500
+	queueSize     = 64
+)
+
+// Store is the part of the database the notifier reads from. database.DB
+// implements it.
+type Store interface {
+	ClaimLiveNotification(channel_id string, cooldown time.Duration) (bool, error)
+	GetChannelInfo(user_id string) (*model.Channel, error)
+	GetFollowers(user_id string, first int, after string) (*model.FollowersResult, error)
+	NotificationTargets(user_ids []string) ([]database.NotificationTarget, error)
+	CreateActivities(sender_id string, target_ids []string, activity_type string, message string) error
+}
+
+// Mailer sends a single email, utils.SendMail fits.
+type Mailer func(recipient string, subject string, body string, textBody string) (bool, error)
+
+// LiveNotifier tells followers that a channel went live. Channels are queued
+// by GoLive and worked off by Run, so a long follower list never holds up the
+// webhook that reported the stream.
+type LiveNotifier struct {
+	store    Store
+	pusher   Pusher
+	mailer   Mailer
+	cooldown time.Duration
+	queue    chan string
+}
+
+// NewLiveNotifier returns a notifier that pushes through pusher and mails
+// through mailer. Either may be nil to skip that channel.
+func NewLiveNotifier(store Store, pusher Pusher, mailer Mailer, cooldown time.Duration) *LiveNotifier {
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+
+	return &LiveNotifier{
+		store:    store,
+		pusher:   pusher,
+		mailer:   mailer,
+		cooldown: cooldown,
+		queue:    make(chan string, queueSize),
+	}
+}
+
+// GoLive queues the followers of channel_id to be notified. It never blocks,
+// when the queue is full the channel is dropped and logged.
+func (n *LiveNotifier) GoLive(channel_id string) {
+	select {
+	case n.queue <- channel_id:
+	default:
+		log.Printf("Live notification queue is full, dropping channel %s", channel_id)
+	}
+}
+
+// Run works off queued channels until ctx is done.
+func (n *LiveNotifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case channel_id := <-n.queue:
+			if err := n.notify(ctx, channel_id); err != nil {
+				log.Printf("Could not notify followers of %s: %v", channel_id, err)
+			}
+		}
+	}
+}
+
+func (n *LiveNotifier) notify(ctx context.Context, channel_id string) error {
+	claimed, err := n.store.ClaimLiveNotification(channel_id, n.cooldown)
+	if err != nil || !claimed {
+		return err
+	}
+
+	channel, err := n.store.GetChannelInfo(channel_id)
+	if err != nil {
+		return err
+	}
+
+	message := liveMessage(channel)
+
+	after := ""
+	for ctx.Err() == nil {
+		page, err := n.store.GetFollowers(channel_id, followersPage, after)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(page.Edges))
+		for _, edge := range page.Edges {
+			ids = append(ids, edge.Node.ID)
+		}
+
+		if err := n.store.CreateActivities(channel_id, ids, "live", message); err != nil {
+			return err
+		}
+
+		targets, err := n.store.NotificationTargets(ids)
+		if err != nil {
+			return err
+		}
+
+		n.deliver(channel, message, targets)
+
+		if !page.PageInfo.HasNextPage || page.PageInfo.EndCursor == after {
+			return nil
+		}
+		after = page.PageInfo.EndCursor
+	}
+
+	return ctx.Err()
+}
+
+// deliver sends the push and email copies. A follower that can't be reached
+// is logged and skipped, it already has the activity.
+func (n *LiveNotifier) deliver(channel *model.Channel, message string, targets []database.NotificationTarget) {
+	title := broadcasterName(channel) + " is live"
+
+	if n.pusher != nil {
+		var tokens []string
+		for _, target := range targets {
+			if target.PushToken != "" {
+				tokens = append(tokens, target.PushToken)
+			}
+		}
+
+		if len(tokens) > 0 {
+			if err := n.pusher.Push(tokens, title, message, map[string]string{"channel_id": channel.UserID}); err != nil {
+				log.Printf("Could not push live notification for %s: %v", channel.UserID, err)
+			}
+		}
+	}
+
+	if n.mailer == nil {
+		return
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/" + channelPath(channel)
+
+	for _, target := range targets {
+		if !target.EmailOptIn || target.Email == "" {
+			continue
+		}
+
+		n.mailer(
+			target.Email,
+			title+" on Glitchd",
+			"<h1>"+html.EscapeString(title)+"</h1><p>"+html.EscapeString(message)+"</p><p><a href=\""+html.EscapeString(link)+"\">Watch now</a></p>",
+			title+": "+message+" "+link,
+		)
+	}
+}
+
+// liveMessage prefers the notification the broadcaster wrote for their
+// channel.
+func liveMessage(channel *model.Channel) string {
+	if channel.Notification != "" {
+		return channel.Notification
+	}
+
+	if channel.Title != "" {
+		return fmt.Sprintf("%s went live: %s", broadcasterName(channel), channel.Title)
+	}
+
+	return broadcasterName(channel) + " went live"
+}
+
+func broadcasterName(channel *model.Channel) string {
+	if channel.Broadcaster != nil && channel.Broadcaster.Username != "" {
+		return channel.Broadcaster.Username
+	}
+
+	return "A channel you follow"
+}
+
+func channelPath(channel *model.Channel) string {
+	if channel.Broadcaster != nil && channel.Broadcaster.Username != "" {
+		return channel.Broadcaster.Username
+	}
+
+	return channel.UserID
+}
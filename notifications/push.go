@@ -0,0 +1,90 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const expoPushURL = "https://exp.host/--/api/v2/push/send"
+
+// Expo accepts at most this many messages per request.
+const expoBatchSize = 100
+
+// Pusher delivers a notification to mobile devices.
+type Pusher interface {
+	Push(tokens []string, title string, body string, data map[string]string) error
+}
+
+// ExpoPusher sends pushes through the Expo push service the mobile app
+// registers its tokens with.
+type ExpoPusher struct {
+	accessToken string
+	client      *http.Client
+}
+
+// NewExpoPusher returns a pusher authenticated with accessToken, which may be
+// empty unless push security is enabled for the Expo project.
+func NewExpoPusher(accessToken string) *ExpoPusher {
+	return &ExpoPusher{accessToken: accessToken, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type expoMessage struct {
+	To    string            `json:"to"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+	Sound string            `json:"sound"`
+}
+
+func (p *ExpoPusher) Push(tokens []string, title string, body string, data map[string]string) error {
+	for start := 0; start < len(tokens); start += expoBatchSize {
+		end := start + expoBatchSize
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+
+		messages := make([]expoMessage, 0, end-start)
+		for _, token := range tokens[start:end] {
+			messages = append(messages, expoMessage{To: token, Title: title, Body: body, Data: data, Sound: "default"})
+		}
+
+		if err := p.send(messages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *ExpoPusher) send(messages []expoMessage) error {
+	payload, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, expoPushURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if p.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.accessToken)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("expo push failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package playback
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Audience is the kind of Mux resource a token unlocks.
+type Audience string
+
+const (
+	Video      Audience = "v"
+	Thumbnail  Audience = "t"
+	GIF        Audience = "g"
+	Storyboard Audience = "s"
+)
+
+const DefaultTTL = time.Hour
+
+var ErrNotConfigured = errors.New("Signed playback is not configured")
+
+// Signer mints Mux playback tokens with a signing key created in the Mux
+// dashboard.
+type Signer struct {
+	keyID string
+	key   *rsa.PrivateKey
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewSigner parses privateKey, a PEM encoded RSA key that may be base64
+// encoded the way Mux hands it out.
+func NewSigner(keyID string, privateKey string, ttl time.Duration) (*Signer, error) {
+	pem := []byte(privateKey)
+	if !strings.HasPrefix(strings.TrimSpace(privateKey), "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privateKey))
+		if err != nil {
+			return nil, err
+		}
+		pem = decoded
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	return &Signer{keyID: keyID, key: key, ttl: ttl, now: time.Now}, nil
+}
+
+// NewSignerFromEnv reads the signing key from MUX_SIGNING_KEY_ID and
+// MUX_SIGNING_KEY, and the token lifetime from PLAYBACK_TOKEN_TTL. It returns
+// ErrNotConfigured when no key is set.
+func NewSignerFromEnv() (*Signer, error) {
+	keyID := os.Getenv("MUX_SIGNING_KEY_ID")
+	privateKey := os.Getenv("MUX_SIGNING_KEY")
+
+	if keyID == "" || privateKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	ttl := DefaultTTL
+	if value := os.Getenv("PLAYBACK_TOKEN_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		ttl = parsed
+	}
+
+	return NewSigner(keyID, privateKey, ttl)
+}
+
+// ExpiresAt returns when tokens signed now stop working.
+func (s *Signer) ExpiresAt() time.Time {
+	return s.now().Add(s.ttl).Truncate(time.Second)
+}
+
+// Sign returns a token that lets its holder load aud of playbackID until
+// ExpiresAt.
+func (s *Signer) Sign(playbackID string, aud Audience) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": playbackID,
+		"aud": string(aud),
+		"exp": s.ExpiresAt().Unix(),
+		"kid": s.keyID,
+	})
+	token.Header["kid"] = s.keyID
+
+	return token.SignedString(s.key)
+}
@@ -0,0 +1,125 @@
+package playback
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return key, string(encoded)
+}
+
+func TestSignClaims(t *testing.T) {
+	key, encoded := testKey(t)
+	now := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	// Mux hands signing keys out base64 encoded.
+	signer, err := NewSigner("key-123", base64.StdEncoding.EncodeToString([]byte(encoded)), 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.now = func() time.Time { return now }
+
+	signed, err := signer.Sign("playback-abc", Video)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	}, jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Method != jwt.SigningMethodRS256 {
+		t.Errorf("alg = %v, want RS256", token.Method.Alg())
+	}
+
+	if token.Header["kid"] != "key-123" {
+		t.Errorf("header kid = %v, want key-123", token.Header["kid"])
+	}
+
+	want := map[string]interface{}{
+		"sub": "playback-abc",
+		"aud": "v",
+		"kid": "key-123",
+		"exp": float64(now.Add(15 * time.Minute).Unix()),
+	}
+
+	for name, value := range want {
+		if claims[name] != value {
+			t.Errorf("%s = %v, want %v", name, claims[name], value)
+		}
+	}
+}
+
+func TestSignAudiences(t *testing.T) {
+	_, encoded := testKey(t)
+
+	signer, err := NewSigner("key-123", encoded, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, aud := range []Audience{Video, Thumbnail, GIF, Storyboard} {
+		signed, err := signer.Sign("playback-abc", aud)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(signed, claims); err != nil {
+			t.Fatal(err)
+		}
+
+		if claims["aud"] != string(aud) {
+			t.Errorf("aud = %v, want %v", claims["aud"], aud)
+		}
+	}
+}
+
+func TestExpiredTokenIsRejected(t *testing.T) {
+	key, encoded := testKey(t)
+
+	signer, err := NewSigner("key-123", encoded, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := signer.Sign("playback-abc", Video)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	}, jwt.WithTimeFunc(func() time.Time { return time.Now().Add(2 * time.Minute) }))
+
+	if err == nil {
+		t.Error("token is still valid after its ttl")
+	}
+}
+
+func TestNewSignerRejectsBadKey(t *testing.T) {
+	if _, err := NewSigner("key-123", "bm90IGEga2V5", time.Minute); err == nil {
+		t.Error("expected an error for a key that is not PEM")
+	}
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrClosed = errors.New("broker is closed")
+
+// Broker fans events out to every subscriber of a topic. Payloads are opaque
+// bytes so that implementations can carry them across processes.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns a channel of payloads published on topic. The channel is
+	// closed once ctx is done, the subscriber is disconnected for falling behind
+	// or the broker shuts down.
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+	Stats() Stats
+	Close() error
+}
+
+// OverflowPolicy decides what happens when a subscriber's queue is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest queued event to make room for the new one.
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the incoming event.
+	DropNewest
+	// Disconnect closes the subscription so the client can reconnect and resync.
+	Disconnect
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "", "drop_oldest":
+		return DropOldest, nil
+	case "drop_newest":
+		return DropNewest, nil
+	case "disconnect":
+		return Disconnect, nil
+	}
+
+	return DropOldest, fmt.Errorf("unknown overflow policy: %q", s)
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop_newest"
+	case Disconnect:
+		return "disconnect"
+	}
+
+	return "drop_oldest"
+}
+
+type Options struct {
+	// QueueSize is the number of undelivered events buffered per subscriber.
+	QueueSize int
+	Overflow  OverflowPolicy
+}
+
+func DefaultOptions() Options {
+	return Options{
+		QueueSize: 32,
+		Overflow:  DropOldest,
+	}
+}
+
+// Stats are cumulative counters since the broker started.
+type Stats struct {
+	Published     uint64 `json:"published"`
+	Delivered     uint64 `json:"delivered"`
+	DroppedOldest uint64 `json:"dropped_oldest"`
+	DroppedNewest uint64 `json:"dropped_newest"`
+	Disconnected  uint64 `json:"disconnected"`
+	Subscribers   int    `json:"subscribers"`
+}
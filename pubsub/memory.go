@@ -0,0 +1,235 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type subscriber struct {
+	topic  string
+	events chan []byte
+	// wake is signalled whenever an event is queued.
+	wake chan struct{}
+	// done is closed once the subscriber is removed from the broker.
+	done chan struct{}
+
+	mu    sync.Mutex
+	queue [][]byte
+}
+
+// MemoryBroker delivers events to subscribers within the current process only.
+// Every subscriber gets a bounded queue drained by its own goroutine, so a slow
+// client never blocks the publisher or other subscribers.
+type MemoryBroker struct {
+	opts Options
+
+	mu     sync.RWMutex
+	topics map[string]map[*subscriber]struct{}
+	count  int
+	closed bool
+
+	published     atomic.Uint64
+	delivered     atomic.Uint64
+	droppedOldest atomic.Uint64
+	droppedNewest atomic.Uint64
+	disconnected  atomic.Uint64
+}
+
+func NewMemoryBroker(opts Options) *MemoryBroker {
+	if opts.QueueSize < 1 {
+		opts.QueueSize = DefaultOptions().QueueSize
+	}
+
+	return &MemoryBroker{
+		opts:   opts,
+		topics: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	var overflowed []*subscriber
+
+	b.mu.RLock()
+
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+
+	b.published.Add(1)
+
+	for sub := range b.topics[topic] {
+		if !b.enqueue(sub, payload) {
+			overflowed = append(overflowed, sub)
+		}
+	}
+
+	b.mu.RUnlock()
+
+	for _, sub := range overflowed {
+		if b.remove(sub) {
+			b.disconnected.Add(1)
+		}
+	}
+
+	return nil
+}
+
+// enqueue adds payload to the subscriber's queue applying the overflow policy.
+// It reports false when the subscriber should be disconnected.
+func (b *MemoryBroker) enqueue(sub *subscriber, payload []byte) bool {
+	sub.mu.Lock()
+
+	if len(sub.queue) >= b.opts.QueueSize {
+		switch b.opts.Overflow {
+		case DropNewest:
+			sub.mu.Unlock()
+			b.droppedNewest.Add(1)
+			return true
+		case Disconnect:
+			sub.mu.Unlock()
+			return false
+		default:
+			copy(sub.queue, sub.queue[1:])
+			sub.queue = sub.queue[:len(sub.queue)-1]
+			b.droppedOldest.Add(1)
+		}
+	}
+
+	sub.queue = append(sub.queue, payload)
+	sub.mu.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &subscriber{
+		topic:  topic,
+		events: make(chan []byte),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		queue:  make([][]byte, 0, b.opts.QueueSize),
+	}
+
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*subscriber]struct{})
+	}
+	b.topics[topic][sub] = struct{}{}
+	b.count++
+
+	go b.pump(sub)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.remove(sub)
+		case <-sub.done:
+		}
+	}()
+
+	return sub.events, nil
+}
+
+// pump drains the subscriber's queue into its events channel until the
+// subscriber is removed.
+func (b *MemoryBroker) pump(sub *subscriber) {
+	defer close(sub.events)
+
+	for {
+		sub.mu.Lock()
+		if len(sub.queue) == 0 {
+			sub.mu.Unlock()
+
+			select {
+			case <-sub.wake:
+				continue
+			case <-sub.done:
+				return
+			}
+		}
+
+		payload := sub.queue[0]
+		sub.queue[0] = nil
+		sub.queue = sub.queue[1:]
+		sub.mu.Unlock()
+
+		select {
+		case sub.events <- payload:
+			b.delivered.Add(1)
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// remove unregisters sub and reports whether it was still registered.
+func (b *MemoryBroker) remove(sub *subscriber) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.topics[sub.topic]
+	if !ok {
+		return false
+	}
+
+	if _, ok := subs[sub]; !ok {
+		return false
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.topics, sub.topic)
+	}
+	b.count--
+	close(sub.done)
+
+	return true
+}
+
+func (b *MemoryBroker) Stats() Stats {
+	b.mu.RLock()
+	subscribers := b.count
+	b.mu.RUnlock()
+
+	return Stats{
+		Published:     b.published.Load(),
+		Delivered:     b.delivered.Load(),
+		DroppedOldest: b.droppedOldest.Load(),
+		DroppedNewest: b.droppedNewest.Load(),
+		Disconnected:  b.disconnected.Load(),
+		Subscribers:   subscribers,
+	}
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	for topic, subs := range b.topics {
+		for sub := range subs {
+			close(sub.done)
+		}
+		delete(b.topics, topic)
+	}
+	b.count = 0
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package pubsub
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerOverflow(t *testing.T) {
+	tests := []struct {
+		policy   OverflowPolicy
+		queue    []string
+		accepted []bool
+		stats    Stats
+	}{
+		{DropOldest, []string{"2", "3"}, []bool{true, true, true}, Stats{DroppedOldest: 1}},
+		{DropNewest, []string{"1", "2"}, []bool{true, true, true}, Stats{DroppedNewest: 1}},
+		{Disconnect, []string{"1", "2"}, []bool{true, true, false}, Stats{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			b := NewMemoryBroker(Options{QueueSize: 2, Overflow: tt.policy})
+
+			// no pump runs for sub, so its queue only changes through enqueue.
+			sub := &subscriber{wake: make(chan struct{}, 1)}
+
+			var accepted []bool
+			for _, payload := range []string{"1", "2", "3"} {
+				accepted = append(accepted, b.enqueue(sub, []byte(payload)))
+			}
+
+			var queue []string
+			for _, payload := range sub.queue {
+				queue = append(queue, string(payload))
+			}
+
+			if !reflect.DeepEqual(queue, tt.queue) {
+				t.Errorf("queue = %q, want %q", queue, tt.queue)
+			}
+
+			if !reflect.DeepEqual(accepted, tt.accepted) {
+				t.Errorf("accepted = %v, want %v", accepted, tt.accepted)
+			}
+
+			if stats := b.Stats(); stats != tt.stats {
+				t.Errorf("stats = %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerDisconnectsSlowSubscriber(t *testing.T) {
+	b := NewMemoryBroker(Options{QueueSize: 2, Overflow: Disconnect})
+	defer b.Close()
+
+	events, err := b.Subscribe(context.Background(), "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one event may be held by the pump, the rest fill the queue until it overflows.
+	for i := 0; i < 4; i++ {
+		if err := b.Publish(context.Background(), "topic", []byte("event")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeout := time.After(time.Second)
+
+	for {
+		select {
+		case _, ok := <-events:
+			if ok {
+				continue
+			}
+
+			if stats := b.Stats(); stats.Disconnected != 1 || stats.Subscribers != 0 {
+				t.Errorf("stats = %+v, want one disconnect and no subscribers", stats)
+			}
+
+			return
+		case <-timeout:
+			t.Fatal("slow subscriber was not disconnected")
+		}
+	}
+}
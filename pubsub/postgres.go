@@ -0,0 +1,142 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the single Postgres channel every replica LISTENs on. The
+// topic travels inside the payload so topic names are not bound by the
+// identifier length limit of LISTEN.
+const notifyChannel = "glitchd_events"
+
+// Postgres rejects NOTIFY payloads of 8000 bytes or more.
+const maxNotifyPayload = 7999
+
+var ErrPayloadTooLarge = errors.New("payload exceeds the postgres notify limit")
+
+type envelope struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+// PostgresBroker publishes events through LISTEN/NOTIFY so that subscribers on
+// every replica receive them. Notifications are fanned out locally through a
+// MemoryBroker once they arrive.
+type PostgresBroker struct {
+	client   *sql.DB
+	listener *pq.Listener
+	local    *MemoryBroker
+	done     chan struct{}
+}
+
+func NewPostgresBroker(dsn string, opts Options) (*PostgresBroker, error) {
+	client, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Println("Postgres broker listener error: ", err)
+		}
+	})
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		client.Close()
+		return nil, err
+	}
+
+	b := &PostgresBroker{
+		client:   client,
+		listener: listener,
+		local:    NewMemoryBroker(opts),
+		done:     make(chan struct{}),
+	}
+
+	go b.listen()
+
+	return b, nil
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	data, err := json.Marshal(envelope{Topic: topic, Payload: payload})
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxNotifyPayload {
+		return ErrPayloadTooLarge
+	}
+
+	_, err = b.client.ExecContext(ctx, "SELECT pg_notify($1, $2)", notifyChannel, string(data))
+	return err
+}
+
+func (b *PostgresBroker) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	return b.local.Subscribe(ctx, topic)
+}
+
+func (b *PostgresBroker) Stats() Stats {
+	return b.local.Stats()
+}
+
+func (b *PostgresBroker) listen() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case n, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+
+			// A nil notification means the connection was re-established and
+			// anything sent in the meantime is lost.
+			if n == nil {
+				fmt.Println("Postgres broker reconnected, events may have been missed")
+				continue
+			}
+
+			var env envelope
+			if err := json.Unmarshal([]byte(n.Extra), &env); err != nil {
+				fmt.Println("Could not decode broker notification: ", err)
+				continue
+			}
+
+			b.local.Publish(context.Background(), env.Topic, env.Payload)
+		case <-time.After(90 * time.Second):
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *PostgresBroker) Close() error {
+	select {
+	case <-b.done:
+		return nil
+	default:
+	}
+	close(b.done)
+
+	b.local.Close()
+
+	if err := b.listener.Close(); err != nil {
+		b.client.Close()
+		return err
+	}
+
+	return b.client.Close()
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -15,6 +18,11 @@ import (
 	"github.com/glitchd/glitchd-server/directives"
 	"github.com/glitchd/glitchd-server/graph"
 	"github.com/glitchd/glitchd-server/middlewares"
+	"github.com/glitchd/glitchd-server/notifications"
+	"github.com/glitchd/glitchd-server/playback"
+	"github.com/glitchd/glitchd-server/pubsub"
+	"github.com/glitchd/glitchd-server/utils"
+	"github.com/glitchd/glitchd-server/webhooks"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
@@ -37,11 +45,62 @@ func main() {
 	// connect to database.
 	database.DB = database.Connect()
 
+	opts := pubsub.DefaultOptions()
+	if size := os.Getenv("PUBSUB_QUEUE_SIZE"); size != "" {
+		opts.QueueSize, err = strconv.Atoi(size)
+		if err != nil {
+			log.Fatal("Invalid PUBSUB_QUEUE_SIZE: ", err)
+		}
+	}
+	opts.Overflow, err = pubsub.ParseOverflowPolicy(os.Getenv("PUBSUB_OVERFLOW"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// subscriptions fan out through postgres when running more than one replica.
+	var broker pubsub.Broker
+	if os.Getenv("PUBSUB_BROKER") == "postgres" {
+		broker, err = pubsub.NewPostgresBroker(os.Getenv("DATABASE_URL"), opts)
+		if err != nil {
+			log.Fatal("Could not start postgres broker: ", err)
+		}
+	} else {
+		broker = pubsub.NewMemoryBroker(opts)
+	}
+	defer broker.Close()
+
+	expvar.Publish("pubsub", expvar.Func(func() any { return broker.Stats() }))
+
+	// purge expired login codes in the background.
+	go database.DB.SweepTokens(context.Background(), 10*time.Minute)
+
+	// payouts whose transfer got no clear answer from Stripe are settled later.
+	go database.DB.SweepPayouts(context.Background(), 5*time.Minute)
+
 	router := mux.NewRouter()
+	router.Use(middlewares.ClientIPMiddleware)
 	router.Use(middlewares.AuthMiddleware)
 
-	c := graph.Config{Resolvers: &graph.Resolver{Rooms: sync.Map{}, Viewers: sync.Map{}}}
+	// signed playback stays off until a Mux signing key is configured.
+	signer, err := playback.NewSignerFromEnv()
+	if err != nil && !errors.Is(err, playback.ErrNotConfigured) {
+		log.Fatal("Invalid Mux signing key: ", err)
+	}
+
+	// followers are notified in the background when a channel goes live.
+	live := notifications.NewLiveNotifier(database.DB, notifications.NewExpoPusher(os.Getenv("EXPO_ACCESS_TOKEN")), utils.SendMail, notifications.DefaultCooldown)
+	go live.Run(context.Background())
+
+	resolver := &graph.Resolver{Broker: broker, Playback: signer, Live: live}
+
+	// presence left behind by a previous run is cleared on startup, then
+	// viewers that stop sending heartbeats are dropped as they expire.
+	go resolver.SweepPresence(context.Background(), database.PresenceHeartbeat)
+
+	c := graph.Config{Resolvers: resolver}
 	c.Directives.Auth = directives.Auth
+	c.Directives.Owner = directives.Owner
+	c.Directives.HasRole = directives.HasRole
 
 	srv := handler.New(graph.NewExecutableSchema(c))
 	srv.AddTransport(transport.POST{})
@@ -58,10 +117,27 @@ func main() {
 			},
 		},
 		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc:              middlewares.WebsocketInit,
 	})
 
 	router.Handle("/", playground.Handler("GraphQL playground", "/query"))
 	router.Handle("/query", srv)
+	router.Handle("/webhooks/stripe", webhooks.NewStripeHandler(os.Getenv("STRIPE_WEBHOOK_SECRET"), database.DB, resolver)).Methods(http.MethodPost)
+	// events of connected accounts are signed with the Connect endpoint's secret.
+	router.Handle("/webhooks/stripe/connect", webhooks.NewStripeConnectHandler(os.Getenv("STRIPE_CONNECT_WEBHOOK_SECRET"), database.DB)).Methods(http.MethodPost)
+	router.Handle("/webhooks/mux", webhooks.NewMuxHandler(os.Getenv("MUX_WEBHOOK_SECRET"), database.DB, resolver)).Methods(http.MethodPost)
+
+	// broker stats, memstats and the command line are only served on an
+	// internal address, e.g. DEBUG_ADDR=127.0.0.1:6060.
+	if debugAddr := os.Getenv("DEBUG_ADDR"); debugAddr != "" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/vars", expvar.Handler())
+
+		go func() {
+			log.Printf("serving debug vars on http://%s/debug/vars", debugAddr)
+			log.Println(http.ListenAndServe(debugAddr, debug))
+		}()
+	}
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, router))
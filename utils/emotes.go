@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var emoteCode = regexp.MustCompile(`^:[A-Za-z0-9_]+:$`)
+
+// emoji holds the code points emoji are drawn from, skin tones and regional
+// indicators included.
+var emoji = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x23ff, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x303d, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1faff, Stride: 1},
+	},
+}
+
+// emojiJoiners may follow or join emoji: zero width joiners, variation
+// selectors, the keycap mark and the tags of subdivision flags.
+var emojiJoiners = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1},
+		{Lo: 0x20e3, Hi: 0x20e3, Stride: 1},
+		{Lo: 0xfe0e, Hi: 0xfe0f, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+	},
+}
+
+// IsEmoteOnly reports whether message is made up of emote codes such as
+// ":glitch:" and emoji only.
+func IsEmoteOnly(message string) bool {
+	fields := strings.Fields(message)
+
+	if len(fields) == 0 {
+		return false
+	}
+
+	for _, field := range fields {
+		if emoteCode.MatchString(field) {
+			continue
+		}
+
+		if !isEmoji(field) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEmoji(field string) bool {
+	runes := []rune(field)
+
+	if !unicode.Is(emoji, runes[0]) && !isKeycap(runes) {
+		return false
+	}
+
+	for i, r := range runes {
+		if unicode.In(r, emoji, emojiJoiners) || isKeycap(runes[i:]) {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// isKeycap reports whether runes start with a keycap such as "1️⃣".
+func isKeycap(runes []rune) bool {
+	if len(runes) < 2 || !strings.ContainsRune("0123456789#*", runes[0]) {
+		return false
+	}
+
+	if runes[1] == 0xfe0f {
+		return len(runes) > 2 && runes[2] == 0x20e3
+	}
+
+	return runes[1] == 0x20e3
+}
@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestIsEmoteOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    bool
+	}{
+		{"emote code", ":glitch:", true},
+		{"emotes and emoji", ":glitch: 😂 :hype:", true},
+		{"emoji with variation selector", "❤️", true},
+		{"skin tone", "👋🏽", true},
+		{"zwj sequence", "👨‍👩‍👧", true},
+		{"flag", "🇩🇪", true},
+		{"keycap", "1️⃣", true},
+		{"empty", "  ", false},
+		{"text", "hello", false},
+		{"emoji with text", "😂 lol", false},
+		{"carets", "^^^", false},
+		{"backtick", "`", false},
+		{"bare digit", "1", false},
+		{"bare joiner", "‍", false},
+		{"broken emote code", ":glitch", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmoteOnly(tt.message); got != tt.want {
+				t.Errorf("IsEmoteOnly(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/glitchd/glitchd-server/graph/model"
+	muxgo "github.com/muxinc/mux-go/v5"
+)
+
+// Mux asset events carry the whole asset, which stays well below this size.
+const maxMuxPayload = 256 * 1024
+
+// Signatures older than this are rejected so captured requests can't be
+// replayed.
+const muxSignatureTolerance = 5 * time.Minute
+
+var errMuxSignature = errors.New("invalid mux signature")
+
+// MuxStore applies verified Mux events. database.DB implements it.
+type MuxStore interface {
+	ProcessMuxEvent(id string, kind string, apply func(store database.MuxEventStore) error) (bool, error)
+}
+
+// MuxAnnouncer tells clients and followers about what Mux reported.
+type MuxAnnouncer interface {
+	PublishVideoJob(job_id string, status string)
+	AnnounceLive(channel_id string)
+}
+
+// muxNews is what an applied event tells clients and followers about once it
+// is committed.
+type muxNews struct {
+	// live is the channel that just went live.
+	live      string
+	jobID     string
+	jobStatus string
+}
+
+type muxEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type MuxHandler struct {
+	secret    string
+	store     MuxStore
+	announcer MuxAnnouncer
+	now       func() time.Time
+}
+
+// NewMuxHandler returns the endpoint Mux delivers events to. Requests that
+// are not signed with secret are rejected.
+func NewMuxHandler(secret string, store MuxStore, announcer MuxAnnouncer) *MuxHandler {
+	return &MuxHandler{secret: secret, store: store, announcer: announcer, now: time.Now}
+}
+
+func (h *MuxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMuxPayload))
+	if err != nil {
+		http.Error(w, "Could not read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := verifyMuxSignature(payload, r.Header.Get("Mux-Signature"), h.secret, h.now()); err != nil {
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	var event muxEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.ID == "" {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	var news muxNews
+
+	// Mux retries until it gets a 2xx, retries are acknowledged without being
+	// applied again.
+	applied, err := h.store.ProcessMuxEvent(event.ID, event.Type, func(store database.MuxEventStore) error {
+		var err error
+		news, err = h.handle(store, event)
+		return err
+	})
+
+	if err != nil {
+		log.Printf("Could not handle mux event %s (%s): %v", event.ID, event.Type, err)
+		http.Error(w, "Could not handle event", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribers and followers only hear about committed changes.
+	if applied {
+		if news.live != "" {
+			h.announcer.AnnounceLive(news.live)
+		}
+
+		if news.jobID != "" {
+			h.announcer.PublishVideoJob(news.jobID, news.jobStatus)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handle applies event through store and returns what to announce.
+func (h *MuxHandler) handle(store database.MuxEventStore, event muxEvent) (muxNews, error) {
+	switch event.Type {
+	case "video.live_stream.active", "video.live_stream.idle":
+		var stream muxgo.LiveStream
+		if err := json.Unmarshal(event.Data, &stream); err != nil {
+			return muxNews{}, err
+		}
+
+		// only set when the channel just went live, reconnects and late
+		// events are not announced again.
+		channel_id, err := store.SetChannelLive(stream.Id, event.Type == "video.live_stream.active", event.CreatedAt)
+
+		return muxNews{live: channel_id}, err
+	case "video.live_stream.recording":
+		var stream muxgo.LiveStream
+		if err := json.Unmarshal(event.Data, &stream); err != nil {
+			return muxNews{}, err
+		}
+
+		if stream.ActiveAssetId == "" {
+			return muxNews{}, nil
+		}
+
+		if err := store.CreateRecording(stream.Id, stream.ActiveAssetId); err != nil {
+			return muxNews{}, err
+		}
+
+		return setJob(store, stream.ActiveAssetId, database.VideoJobRecording)
+	case "video.asset.ready":
+		var asset muxgo.Asset
+		if err := json.Unmarshal(event.Data, &asset); err != nil {
+			return muxNews{}, err
+		}
+
+		if err := store.AssetReady(assetFromMux(&asset)); err != nil {
+			return muxNews{}, err
+		}
+
+		return setJob(store, asset.Id, database.VideoJobReady)
+	case "video.asset.errored":
+		var asset muxgo.Asset
+		if err := json.Unmarshal(event.Data, &asset); err != nil {
+			return muxNews{}, err
+		}
+
+		return setJob(store, asset.Id, database.VideoJobErrored)
+	}
+
+	return muxNews{}, nil
+}
+
+// setJob stores the job's status, its subscribers are told once it is
+// committed.
+func setJob(store database.MuxEventStore, job_id string, status string) (muxNews, error) {
+	if _, err := store.CreateVideoJob(job_id, status); err != nil {
+		return muxNews{}, err
+	}
+
+	return muxNews{jobID: job_id, jobStatus: status}, nil
+}
+
+// assetFromMux picks the playback id viewers use, preferring a signed one so
+// an asset that was locked down is never served publicly by accident.
+func assetFromMux(asset *muxgo.Asset) database.MuxAsset {
+	result := database.MuxAsset{ID: asset.Id, LiveStreamID: asset.LiveStreamId}
+
+	for _, playback := range asset.PlaybackIds {
+		policy := model.PlaybackPolicy(strings.ToUpper(string(playback.Policy)))
+
+		if !policy.IsValid() {
+			continue
+		}
+
+		if result.PlaybackID == "" || policy == model.PlaybackPolicySigned {
+			result.PlaybackID = playback.Id
+			result.PlaybackPolicy = policy
+		}
+	}
+
+	return result
+}
+
+// verifyMuxSignature checks a Mux-Signature header of the form
+// "t=<unix time>,v1=<hex hmac>", where the hmac covers "<unix time>.<body>".
+func verifyMuxSignature(payload []byte, header string, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 || secret == "" {
+		return errMuxSignature
+	}
+
+	signedAt := time.Unix(seconds, 0)
+	if now.Sub(signedAt) > muxSignatureTolerance || signedAt.Sub(now) > muxSignatureTolerance {
+		return errMuxSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return errMuxSignature
+}
@@ -0,0 +1,245 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+)
+
+const testMuxSecret = "mux_test_glitchd"
+
+// fakeMuxStore records the calls the handler makes instead of touching the
+// database.
+type fakeMuxStore struct {
+	processed map[string]bool
+	calls     []string
+	err       error
+}
+
+func newFakeMuxStore() *fakeMuxStore {
+	return &fakeMuxStore{processed: map[string]bool{}}
+}
+
+func (s *fakeMuxStore) ProcessMuxEvent(id string, kind string, apply func(store database.MuxEventStore) error) (bool, error) {
+	if s.processed[id] {
+		return false, nil
+	}
+
+	if err := apply(s); err != nil {
+		return false, err
+	}
+
+	s.processed[id] = true
+	return true, nil
+}
+
+func (s *fakeMuxStore) SetChannelLive(livestream_id string, live bool, at time.Time) (string, error) {
+	s.calls = append(s.calls, fmt.Sprintf("SetChannelLive %s %t %d", livestream_id, live, at.Unix()))
+
+	if !live {
+		return "", s.err
+	}
+
+	return "7d1f9a60-0c4e-4a3b-b6e1-5f2c8d9e0a17", s.err
+}
+
+func (s *fakeMuxStore) CreateRecording(livestream_id string, asset_id string) error {
+	s.calls = append(s.calls, "CreateRecording "+livestream_id+" "+asset_id)
+	return s.err
+}
+
+func (s *fakeMuxStore) AssetReady(asset database.MuxAsset) error {
+	s.calls = append(s.calls, fmt.Sprintf("AssetReady %s %s %s %s", asset.ID, asset.LiveStreamID, asset.PlaybackID, asset.PlaybackPolicy))
+	return s.err
+}
+
+func (s *fakeMuxStore) CreateVideoJob(job_id string, status string) (string, error) {
+	s.calls = append(s.calls, "CreateVideoJob "+job_id+" "+status)
+	return status, s.err
+}
+
+// fakeJobs records the job states pushed to subscribers and the channels
+// announced as live.
+type fakeJobs struct {
+	published []string
+	live      []string
+}
+
+func (j *fakeJobs) PublishVideoJob(job_id string, status string) {
+	j.published = append(j.published, job_id+" "+status)
+}
+
+func (j *fakeJobs) AnnounceLive(channel_id string) {
+	j.live = append(j.live, channel_id)
+}
+
+// deliverMux posts payload to the handler the way Mux does, signed with
+// secret at signedAt.
+func deliverMux(h http.Handler, payload []byte, secret string, signedAt time.Time) *httptest.ResponseRecorder {
+	timestamp := fmt.Sprint(signedAt.Unix())
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/mux", bytes.NewReader(payload))
+	req.Header.Set("Mux-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestMuxHandlerFixtures(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		calls     []string
+		published []string
+	}{
+		{
+			"mux_live_stream_active.json",
+			[]string{"SetChannelLive ZEBrNTpHC02iUah025KM3te6ylM7W4S4silsrFtUkn3Ag true 1710439345"},
+			nil,
+		},
+		{
+			"mux_live_stream_idle.json",
+			[]string{"SetChannelLive ZEBrNTpHC02iUah025KM3te6ylM7W4S4silsrFtUkn3Ag false 1710449231"},
+			nil,
+		},
+		{
+			"mux_live_stream_recording.json",
+			[]string{
+				"CreateRecording ZEBrNTpHC02iUah025KM3te6ylM7W4S4silsrFtUkn3Ag 6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk",
+				"CreateVideoJob 6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk recording",
+			},
+			[]string{"6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk recording"},
+		},
+		{
+			"mux_asset_ready.json",
+			[]string{
+				"AssetReady 6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk ZEBrNTpHC02iUah025KM3te6ylM7W4S4silsrFtUkn3Ag x3tsc01wL3H00Mp01JPxGIa9Ta5aOO02rMFvBH8lRn8U00I SIGNED",
+				"CreateVideoJob 6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk ready",
+			},
+			[]string{"6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk ready"},
+		},
+		{
+			"mux_asset_errored.json",
+			[]string{"CreateVideoJob Kz9d4b01Lq8YhV2c00nF3xT7wQp5R6sJm1aE02uG8oXk errored"},
+			[]string{"Kz9d4b01Lq8YhV2c00nF3xT7wQp5R6sJm1aE02uG8oXk errored"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			store := newFakeMuxStore()
+			jobs := &fakeJobs{}
+			rec := deliverMux(NewMuxHandler(testMuxSecret, store, jobs), fixture(t, tt.fixture), testMuxSecret, time.Now())
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			if !reflect.DeepEqual(store.calls, tt.calls) {
+				t.Errorf("calls = %q, want %q", store.calls, tt.calls)
+			}
+
+			if !reflect.DeepEqual(jobs.published, tt.published) {
+				t.Errorf("published = %q, want %q", jobs.published, tt.published)
+			}
+		})
+	}
+}
+
+func TestMuxHandlerRejectsBadSignature(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		signedAt time.Time
+	}{
+		{"wrong secret", "mux_someone_else", time.Now()},
+		{"replayed", testMuxSecret, time.Now().Add(-time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeMuxStore()
+			rec := deliverMux(NewMuxHandler(testMuxSecret, store, &fakeJobs{}), fixture(t, "mux_live_stream_active.json"), tt.secret, tt.signedAt)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+
+			if len(store.calls) != 0 {
+				t.Errorf("unsigned event was applied: %q", store.calls)
+			}
+		})
+	}
+}
+
+func TestMuxHandlerSkipsRetries(t *testing.T) {
+	store := newFakeMuxStore()
+	jobs := &fakeJobs{}
+	h := NewMuxHandler(testMuxSecret, store, jobs)
+	payload := fixture(t, "mux_asset_errored.json")
+
+	deliverMux(h, payload, testMuxSecret, time.Now())
+	rec := deliverMux(h, payload, testMuxSecret, time.Now())
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if len(store.calls) != 1 || len(jobs.published) != 1 {
+		t.Errorf("retried event was applied again, calls = %q", store.calls)
+	}
+}
+
+func TestMuxHandlerFailureIsRetried(t *testing.T) {
+	store := newFakeMuxStore()
+	store.err = errors.New("database is down")
+	jobs := &fakeJobs{}
+	h := NewMuxHandler(testMuxSecret, store, jobs)
+	payload := fixture(t, "mux_asset_ready.json")
+
+	if rec := deliverMux(h, payload, testMuxSecret, time.Now()); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	if len(jobs.published) != 0 {
+		t.Errorf("failed event was published: %q", jobs.published)
+	}
+
+	store.err = nil
+
+	if rec := deliverMux(h, payload, testMuxSecret, time.Now()); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if want := []string{"6hnT8w02FRRm8VhqQbTfsbRCjb5ZqQo2kc9zWbLb1Mfk ready"}; !reflect.DeepEqual(jobs.published, want) {
+		t.Errorf("published = %q, want %q", jobs.published, want)
+	}
+}
+
+func TestMuxHandlerAnnouncesGoingLive(t *testing.T) {
+	store := newFakeMuxStore()
+	jobs := &fakeJobs{}
+	h := NewMuxHandler(testMuxSecret, store, jobs)
+
+	deliverMux(h, fixture(t, "mux_live_stream_active.json"), testMuxSecret, time.Now())
+	deliverMux(h, fixture(t, "mux_live_stream_idle.json"), testMuxSecret, time.Now())
+
+	if want := []string{"7d1f9a60-0c4e-4a3b-b6e1-5f2c8d9e0a17"}; !reflect.DeepEqual(jobs.live, want) {
+		t.Errorf("announced = %q, want %q", jobs.live, want)
+	}
+}
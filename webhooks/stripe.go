@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/webhook"
+)
+
+// Stripe sends events well below this size.
+const maxStripePayload = 64 * 1024
+
+// StripeStore applies verified Stripe events. database.DB implements it.
+type StripeStore interface {
+	ProcessStripeEvent(id string, kind string, apply func(store database.StripeEventStore) error) (bool, error)
+}
+
+// Announcer tells viewers about purchases that were settled by Stripe.
+type Announcer interface {
+	AnnounceGift(gift *database.MembershipGift)
+}
+
+type StripeHandler struct {
+	secret    string
+	store     StripeStore
+	announcer Announcer
+	// events limits the event types that are applied, nil applies all of them.
+	events map[string]bool
+}
+
+// NewStripeHandler returns the endpoint Stripe delivers events to. Requests
+// that are not signed with secret are rejected, and so is every request when
+// secret is empty.
+func NewStripeHandler(secret string, store StripeStore, announcer Announcer) *StripeHandler {
+	return &StripeHandler{secret: secret, store: store, announcer: announcer}
+}
+
+// NewStripeConnectHandler returns the endpoint for events of connected
+// accounts. Only account.updated is applied, anything else a connected
+// account sends is acknowledged and ignored.
+func NewStripeConnectHandler(secret string, store StripeStore) *StripeHandler {
+	return &StripeHandler{secret: secret, store: store, events: map[string]bool{"account.updated": true}}
+}
+
+func (h *StripeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStripePayload))
+	if err != nil {
+		http.Error(w, "Could not read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// without a secret stripe-go would accept signatures made with an empty key.
+	if h.secret == "" {
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), h.secret)
+	if err != nil {
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	if h.events != nil && !h.events[event.Type] {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var gift *database.MembershipGift
+
+	// Stripe delivers events at least once, retries are acknowledged without
+	// being applied again. A failed event is answered with a 500 so Stripe
+	// retries it later.
+	applied, err := h.store.ProcessStripeEvent(event.ID, event.Type, func(store database.StripeEventStore) error {
+		var err error
+		gift, err = h.handle(store, event)
+		return err
+	})
+
+	if err != nil {
+		log.Printf("Could not handle stripe event %s (%s): %v", event.ID, event.Type, err)
+		http.Error(w, "Could not handle event", http.StatusInternalServerError)
+		return
+	}
+
+	// gifts are announced once the memberships are committed.
+	if applied && gift != nil && h.announcer != nil {
+		h.announcer.AnnounceGift(gift)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handle applies event through store. It returns the gift to announce when the
+// event fulfilled one.
+func (h *StripeHandler) handle(store database.StripeEventStore, event stripe.Event) (*database.MembershipGift, error) {
+	switch event.Type {
+	case "checkout.session.completed":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, err
+		}
+
+		checkout, err := checkoutFromSession(&session)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := store.CompleteCheckout(checkout); err != nil {
+			return nil, err
+		}
+
+		if checkout.Kind != database.CheckoutGift {
+			return nil, nil
+		}
+
+		gift, fulfilled, err := store.FulfillGift(checkout.GiftID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fulfilled {
+			return nil, nil
+		}
+
+		return gift, nil
+	case "invoice.paid":
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return nil, err
+		}
+
+		if invoice.Subscription == nil {
+			return nil, nil
+		}
+
+		return nil, store.RenewSubscription(invoice.Subscription.ID, paidUntil(&invoice))
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var subscription stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &subscription); err != nil {
+			return nil, err
+		}
+
+		state := subscriptionFromStripe(&subscription)
+		state.EventAt = time.Unix(event.Created, 0)
+
+		return nil, store.SyncSubscription(state)
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, err
+		}
+
+		if charge.PaymentIntent == "" {
+			return nil, nil
+		}
+
+		return nil, store.RefundPayment(database.StripeRefund{
+			PaymentIntentID: charge.PaymentIntent,
+			Amount:          charge.Amount,
+			AmountRefunded:  charge.AmountRefunded,
+			Refunded:        charge.Refunded,
+		})
+	case "account.updated":
+		var account stripe.Account
+		if err := json.Unmarshal(event.Data.Raw, &account); err != nil {
+			return nil, err
+		}
+
+		return nil, store.SetPayoutsEnabled(account.ID, account.PayoutsEnabled)
+	}
+
+	return nil, nil
+}
+
+// checkoutFromSession reads what was bought from the metadata set when the
+// session was created.
+func checkoutFromSession(session *stripe.CheckoutSession) (database.StripeCheckout, error) {
+	checkout := database.StripeCheckout{
+		SessionID: session.ID,
+		Kind:      session.Metadata["kind"],
+		UserID:    session.Metadata["user_id"],
+		ChannelID: session.Metadata["channel_id"],
+		Tier:      session.Metadata["tier"],
+		GiftID:    session.Metadata["gift_id"],
+	}
+
+	if checkout.UserID == "" {
+		checkout.UserID = session.ClientReferenceID
+	}
+
+	if checkout.UserID == "" {
+		return checkout, fmt.Errorf("checkout session %s has no user", session.ID)
+	}
+
+	if session.PaymentIntent != nil {
+		checkout.PaymentIntentID = session.PaymentIntent.ID
+	}
+
+	if session.Subscription != nil {
+		checkout.SubscriptionID = session.Subscription.ID
+	}
+
+	if flakes := session.Metadata["flakes"]; flakes != "" {
+		amount, err := strconv.Atoi(flakes)
+		if err != nil {
+			return checkout, fmt.Errorf("checkout session %s has invalid flakes: %w", session.ID, err)
+		}
+		checkout.Flakes = amount
+	}
+
+	return checkout, nil
+}
+
+func subscriptionFromStripe(subscription *stripe.Subscription) database.StripeSubscription {
+	result := database.StripeSubscription{
+		ID:                subscription.ID,
+		Status:            string(subscription.Status),
+		CancelAtPeriodEnd: subscription.CancelAtPeriodEnd,
+		UserID:            subscription.Metadata["user_id"],
+		ChannelID:         subscription.Metadata["channel_id"],
+		Tier:              subscription.Metadata["tier"],
+	}
+
+	if subscription.CurrentPeriodEnd > 0 {
+		result.ExpiresAt = time.Unix(subscription.CurrentPeriodEnd, 0)
+	}
+
+	return result
+}
+
+// paidUntil returns the end of the latest period an invoice paid for.
+func paidUntil(invoice *stripe.Invoice) time.Time {
+	var end int64
+
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Period != nil && line.Period.End > end {
+				end = line.Period.End
+			}
+		}
+	}
+
+	if end == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(end, 0)
+}
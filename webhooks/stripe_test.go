@@ -0,0 +1,275 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glitchd/glitchd-server/database"
+	"github.com/stripe/stripe-go/webhook"
+)
+
+const testSecret = "whsec_test_glitchd"
+
+// fakeStore records the calls the handler makes instead of touching the
+// database.
+type fakeStore struct {
+	processed map[string]bool
+	gifts     map[string]bool
+	calls     []string
+	checkouts []database.StripeCheckout
+	err       error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{processed: map[string]bool{}, gifts: map[string]bool{}}
+}
+
+// fakeAnnouncer records the gifts that would be announced in chat.
+type fakeAnnouncer struct {
+	gifts []string
+}
+
+func (a *fakeAnnouncer) AnnounceGift(gift *database.MembershipGift) {
+	a.gifts = append(a.gifts, gift.ID)
+}
+
+func (s *fakeStore) ProcessStripeEvent(id string, kind string, apply func(store database.StripeEventStore) error) (bool, error) {
+	if s.processed[id] {
+		return false, nil
+	}
+
+	if err := apply(s); err != nil {
+		return false, err
+	}
+
+	s.processed[id] = true
+	return true, nil
+}
+
+func (s *fakeStore) CompleteCheckout(checkout database.StripeCheckout) error {
+	s.calls = append(s.calls, "CompleteCheckout "+checkout.SessionID)
+	s.checkouts = append(s.checkouts, checkout)
+	return s.err
+}
+
+func (s *fakeStore) SyncSubscription(subscription database.StripeSubscription) error {
+	s.calls = append(s.calls, fmt.Sprintf("SyncSubscription %s %s %d %t", subscription.ID, subscription.Status, subscription.ExpiresAt.Unix(), subscription.CancelAtPeriodEnd))
+	return s.err
+}
+
+func (s *fakeStore) RenewSubscription(subscription_id string, expires_at time.Time) error {
+	s.calls = append(s.calls, fmt.Sprintf("RenewSubscription %s %d", subscription_id, expires_at.Unix()))
+	return s.err
+}
+
+func (s *fakeStore) RefundPayment(refund database.StripeRefund) error {
+	s.calls = append(s.calls, fmt.Sprintf("RefundPayment %s %d/%d %t", refund.PaymentIntentID, refund.AmountRefunded, refund.Amount, refund.Refunded))
+	return s.err
+}
+
+func (s *fakeStore) FulfillGift(gift_id string) (*database.MembershipGift, bool, error) {
+	s.calls = append(s.calls, "FulfillGift "+gift_id)
+
+	// only the first delivery hands out the gift.
+	fulfilled := !s.gifts[gift_id]
+	s.gifts[gift_id] = true
+
+	return &database.MembershipGift{ID: gift_id, Count: 3}, fulfilled, s.err
+}
+
+func (s *fakeStore) SetPayoutsEnabled(account_id string, enabled bool) error {
+	s.calls = append(s.calls, fmt.Sprintf("SetPayoutsEnabled %s %t", account_id, enabled))
+	return s.err
+}
+
+// fixture loads a recorded event from testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+// deliver posts payload to the handler the way Stripe does, signed with secret.
+func deliver(h http.Handler, payload []byte, secret string) *httptest.ResponseRecorder {
+	now := time.Now()
+	signature := hex.EncodeToString(webhook.ComputeSignature(now, payload, secret))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now.Unix(), signature))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestStripeHandlerFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		calls   []string
+	}{
+		{"checkout_session_completed_flakes.json", []string{"CompleteCheckout cs_test_a1Flk9cQ3VbWnGm0yB8dTqP2rXs4uZ7e"}},
+		{"checkout_session_completed_membership.json", []string{"CompleteCheckout cs_test_b1Mem4kR8sXcPz2hD6vNwQ9aTyU3eLf0"}},
+		{"invoice_paid.json", []string{"RenewSubscription sub_1OqH9qLkdIwHu7ixTnS3wE4r 1715183961"}},
+		{"customer_subscription_updated.json", []string{"SyncSubscription sub_1OqH9qLkdIwHu7ixTnS3wE4r past_due 1715183961 true"}},
+		{"customer_subscription_deleted.json", []string{"SyncSubscription sub_1OqH9qLkdIwHu7ixTnS3wE4r canceled 1715183961 false"}},
+		{"checkout_session_completed_gift.json", []string{"CompleteCheckout cs_test_c1Gft7pW2nYxQr5kE8vBmT4aZsL9dHu3", "FulfillGift 3c9a1e7b-5d2f-4b8e-a6c0-9f1d2e3b4a5c"}},
+		{"charge_refunded.json", []string{"RefundPayment pi_3OqH2hLkdIwHu7ix1nVbC8Dk 499/499 true"}},
+		{"account_updated.json", []string{"SetPayoutsEnabled acct_1OtB4dQw8rLkZp2X true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			store := newFakeStore()
+			rec := deliver(NewStripeHandler(testSecret, store, &fakeAnnouncer{}), fixture(t, tt.fixture), testSecret)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			if !reflect.DeepEqual(store.calls, tt.calls) {
+				t.Errorf("calls = %q, want %q", store.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestStripeHandlerCheckoutMetadata(t *testing.T) {
+	store := newFakeStore()
+	h := NewStripeHandler(testSecret, store, &fakeAnnouncer{})
+
+	deliver(h, fixture(t, "checkout_session_completed_flakes.json"), testSecret)
+	deliver(h, fixture(t, "checkout_session_completed_membership.json"), testSecret)
+
+	want := []database.StripeCheckout{
+		{
+			SessionID:       "cs_test_a1Flk9cQ3VbWnGm0yB8dTqP2rXs4uZ7e",
+			PaymentIntentID: "pi_3OqH2hLkdIwHu7ix1nVbC8Dk",
+			Kind:            database.CheckoutFlakes,
+			UserID:          "0b5e6c2f-3f6e-4a52-9a47-8cf0f1c3a2d1",
+			Flakes:          500,
+		},
+		{
+			SessionID:      "cs_test_b1Mem4kR8sXcPz2hD6vNwQ9aTyU3eLf0",
+			SubscriptionID: "sub_1OqH9qLkdIwHu7ixTnS3wE4r",
+			Kind:           database.CheckoutMembership,
+			UserID:         "0b5e6c2f-3f6e-4a52-9a47-8cf0f1c3a2d1",
+			ChannelID:      "7d1f9a60-0c4e-4a3b-b6e1-5f2c8d9e0a17",
+			Tier:           "1",
+		},
+	}
+
+	if !reflect.DeepEqual(store.checkouts, want) {
+		t.Errorf("checkouts = %+v, want %+v", store.checkouts, want)
+	}
+}
+
+func TestStripeHandlerRejectsBadSignature(t *testing.T) {
+	store := newFakeStore()
+	rec := deliver(NewStripeHandler(testSecret, store, &fakeAnnouncer{}), fixture(t, "charge_refunded.json"), "whsec_someone_else")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if len(store.calls) != 0 {
+		t.Errorf("unsigned event was applied: %q", store.calls)
+	}
+}
+
+func TestStripeHandlerSkipsRetries(t *testing.T) {
+	store := newFakeStore()
+	h := NewStripeHandler(testSecret, store, &fakeAnnouncer{})
+	payload := fixture(t, "checkout_session_completed_flakes.json")
+
+	deliver(h, payload, testSecret)
+	rec := deliver(h, payload, testSecret)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if len(store.calls) != 1 {
+		t.Errorf("retried event was applied %d times", len(store.calls))
+	}
+}
+
+func TestStripeHandlerFailureIsRetried(t *testing.T) {
+	store := newFakeStore()
+	store.err = errors.New("database is down")
+	h := NewStripeHandler(testSecret, store, &fakeAnnouncer{})
+	payload := fixture(t, "invoice_paid.json")
+
+	if rec := deliver(h, payload, testSecret); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	store.err = nil
+
+	if rec := deliver(h, payload, testSecret); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if len(store.calls) != 2 {
+		t.Errorf("failed event was not applied again, calls = %q", store.calls)
+	}
+}
+
+func TestStripeHandlerAnnouncesGiftOnce(t *testing.T) {
+	store := newFakeStore()
+	announcer := &fakeAnnouncer{}
+	h := NewStripeHandler(testSecret, store, announcer)
+	payload := fixture(t, "checkout_session_completed_gift.json")
+
+	deliver(h, payload, testSecret)
+
+	// a retry that is not recognised as one still must not announce again.
+	delete(store.processed, "evt_1OrA3nLkdIwHu7ixJ4sD8kWq")
+	deliver(h, payload, testSecret)
+
+	if want := []string{"3c9a1e7b-5d2f-4b8e-a6c0-9f1d2e3b4a5c"}; !reflect.DeepEqual(announcer.gifts, want) {
+		t.Errorf("announced = %q, want %q", announcer.gifts, want)
+	}
+}
+
+func TestStripeHandlerRequiresSecret(t *testing.T) {
+	store := newFakeStore()
+	rec := deliver(NewStripeHandler("", store, &fakeAnnouncer{}), fixture(t, "checkout_session_completed_flakes.json"), "")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if len(store.calls) != 0 {
+		t.Errorf("event signed with an empty secret was applied: %q", store.calls)
+	}
+}
+
+func TestStripeConnectHandlerOnlyAppliesAccountUpdates(t *testing.T) {
+	store := newFakeStore()
+	h := NewStripeConnectHandler(testSecret, store)
+
+	for _, name := range []string{"checkout_session_completed_flakes.json", "charge_refunded.json", "account_updated.json"} {
+		if rec := deliver(h, fixture(t, name), testSecret); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", name, rec.Code, http.StatusOK)
+		}
+	}
+
+	if want := []string{"SetPayoutsEnabled acct_1OtB4dQw8rLkZp2X true"}; !reflect.DeepEqual(store.calls, want) {
+		t.Errorf("calls = %q, want %q", store.calls, want)
+	}
+}